@@ -0,0 +1,41 @@
+package main
+
+import (
+	"ecs-ip/internal/web"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+)
+
+// ansibleCommand prints Ansible dynamic inventory, so the binary can be used as an inventory script:
+// ansible-playbook -i inventory.sh where inventory.sh runs `ecs-ip ansible "$@"`
+func ansibleCommand(args []string) {
+	flags := flag.NewFlagSet("ansible", flag.ExitOnError)
+	flags.Bool("list", true, "print the whole inventory, it is the default")
+	host := flags.String("host", "", "print variables of the host")
+	filter := web.Filter{}
+	flags.StringVar(&filter.App, "app", "", "only hosts of services of the app")
+	flags.StringVar(&filter.Env, "env", "", "only hosts of services of the env")
+	flags.StringVar(&filter.Cluster, "cluster", "", "only hosts of the cluster")
+	flags.StringVar(&filter.Account, "account", "", "only hosts of the account")
+	flags.StringVar(&filter.Search, "q", "", "only hosts of services matching the text, IP address or CIDR")
+	_ = flags.Parse(args)
+
+	clusters := web.Crawl(strings.Split(os.Getenv("REGION"), ","))
+	inventory := web.AnsibleInventory(web.Filtered(clusters, filter))
+
+	var res any = inventory
+	if *host != "" {
+		// _meta is always set, so Ansible does not call --host, but the script must still support it
+		res = inventory["_meta"].(map[string]any)["hostvars"].(map[string]map[string]any)[*host]
+		if res == nil {
+			res = map[string]any{}
+		}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(res); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"ecs-ip/internal/web"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// consulCommand syncs tasks to the Consul catalog every CACHE_TTL, or once with --once
+func consulCommand(args []string) {
+	flags := flag.NewFlagSet("consul", flag.ExitOnError)
+	once := flags.Bool("once", false, "sync once and exit")
+	_ = flags.Parse(args)
+
+	sync, err := web.NewConsulSync(web.ConsulConfig{
+		Address:         os.Getenv("CONSUL_HTTP_ADDR"),
+		Token:           os.Getenv("CONSUL_HTTP_TOKEN"),
+		Datacenter:      os.Getenv("CONSUL_DATACENTER"),
+		ServiceTemplate: os.Getenv("CONSUL_SERVICE_TEMPLATE"),
+	}, nil)
+	if err != nil {
+		panic(fmt.Sprintf("invalid CONSUL_SERVICE_TEMPLATE: %s", err))
+	}
+
+	interval := time.Minute
+	if value := os.Getenv("CACHE_TTL"); value != "" {
+		interval, err = time.ParseDuration(value)
+		if err != nil {
+			panic(fmt.Sprintf("invalid CACHE_TTL: %s", err))
+		}
+		// a zero interval would stop the background refresh and everything fed by it without any error
+		if interval <= 0 {
+			panic(fmt.Sprintf("invalid CACHE_TTL: %s, it must be positive", value))
+		}
+	}
+
+	regions := strings.Split(os.Getenv("REGION"), ",")
+	for {
+		res, err := sync.Sync(web.Crawl(regions))
+		if err != nil {
+			// the next sync retries, registrations are compared again with the catalog
+			log.Printf("consul sync failed: %s", err)
+		} else {
+			log.Printf("consul sync: %d registered, %d deregistered, %d unchanged", res.Registered, res.Deregistered, res.Unchanged)
+		}
+		if *once {
+			if err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+		time.Sleep(interval)
+	}
+}
@@ -3,13 +3,30 @@ package main
 import (
 	"ecs-ip/internal/web"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/miekg/dns"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ansible" {
+		ansibleCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		renderCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "consul" {
+		consulCommand(os.Args[2:])
+		return
+	}
+
 	password := os.Getenv("ADMIN_PASSWORD")
 	if password == "" {
 		panic("ADMIN_PASSWORD is not set")
@@ -17,7 +34,88 @@ func main() {
 
 	region := os.Getenv("REGION")
 	fmt.Printf("region is %v", region)
-	server := web.NewServer(region, password)
+
+	// inventory is crawled again in background with this interval
+	cacheTTL := time.Minute
+	if value := os.Getenv("CACHE_TTL"); value != "" {
+		var err error
+		cacheTTL, err = time.ParseDuration(value)
+		if err != nil {
+			panic(fmt.Sprintf("invalid CACHE_TTL: %s", err))
+		}
+		// a zero interval would stop the background refresh and everything fed by it without any error
+		if cacheTTL <= 0 {
+			panic(fmt.Sprintf("invalid CACHE_TTL: %s, it must be positive", value))
+		}
+	}
+
+	// containers expose metrics on ports from the Docker label or on the listed container ports
+	discovery := web.DiscoveryConfig{
+		PortLabel: "PROMETHEUS_EXPORTER_PORT",
+		PathLabel: "PROMETHEUS_EXPORTER_PATH",
+	}
+	if value, ok := os.LookupEnv("SD_PORT_LABEL"); ok {
+		discovery.PortLabel = value
+	}
+	if value, ok := os.LookupEnv("SD_PATH_LABEL"); ok {
+		discovery.PathLabel = value
+	}
+	if value := os.Getenv("SD_METRICS_PORTS"); value != "" {
+		for _, item := range strings.Split(value, ",") {
+			port, err := strconv.ParseInt(strings.TrimSpace(item), 10, 32)
+			if err != nil {
+				panic(fmt.Sprintf("invalid SD_METRICS_PORTS: %s", err))
+			}
+			discovery.Ports = append(discovery.Ports, int32(port))
+		}
+	}
+
+	server := web.NewServer(web.Config{
+		Region:    region,
+		Password:  password,
+		CacheTTL:  cacheTTL,
+		Discovery: discovery,
+		Exports: web.ExportConfig{
+			SSHNameTemplate:   os.Getenv("SSH_NAME_TEMPLATE"),
+			HostsNameTemplate: os.Getenv("HOSTS_NAME_TEMPLATE"),
+			SSHUser:           os.Getenv("SSH_USER"),
+			SSHBastion:        os.Getenv("SSH_BASTION"),
+			TemplatesDir:      os.Getenv("TEMPLATES_DIR"),
+		},
+		DNS: web.DNSConfig{
+			Zone:         os.Getenv("DNS_ZONE"),
+			NameTemplate: os.Getenv("DNS_NAME_TEMPLATE"),
+		},
+	})
+
+	// gRPC API is served on a separate port when it is set
+	if grpcPort := os.Getenv("GRPC_PORT"); grpcPort != "" {
+		listener, err := net.Listen("tcp", fmt.Sprintf("%v:%v", os.Getenv("HOST"), grpcPort))
+		if err != nil {
+			panic(fmt.Sprintf("cannot listen gRPC port: %s", err))
+		}
+		go func() {
+			if err := server.GRPCServer().Serve(listener); err != nil {
+				panic(fmt.Sprintf("cannot start gRPC server: %s", err))
+			}
+		}()
+	}
+
+	// DNS server answers on UDP and TCP of the same port when it is set
+	if dnsPort := os.Getenv("DNS_PORT"); dnsPort != "" {
+		handler, err := server.DNSHandler()
+		if err != nil {
+			panic(fmt.Sprintf("invalid DNS_NAME_TEMPLATE: %s", err))
+		}
+		for _, network := range []string{"udp", "tcp"} {
+			dnsServer := &dns.Server{Addr: fmt.Sprintf("%v:%v", os.Getenv("HOST"), dnsPort), Net: network, Handler: handler}
+			go func() {
+				if err := dnsServer.ListenAndServe(); err != nil {
+					panic(fmt.Sprintf("cannot start DNS server: %s", err))
+				}
+			}()
+		}
+	}
 
 	host := os.Getenv("HOST")
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
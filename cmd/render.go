@@ -0,0 +1,22 @@
+package main
+
+import (
+	"ecs-ip/internal/web"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// renderCommand crawls the inventory once and writes it as a static site, e.g. `ecs-ip render --out ./site`
+func renderCommand(args []string) {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	out := flags.String("out", "site", "directory of the static site, existing files are overwritten")
+	_ = flags.Parse(args)
+
+	clusters := web.Crawl(strings.Split(os.Getenv("REGION"), ","))
+	if err := web.RenderSite(clusters, *out); err != nil {
+		panic(fmt.Sprintf("cannot render site: %s", err))
+	}
+	fmt.Printf("site is written to %s\n", *out)
+}
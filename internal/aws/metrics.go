@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"context"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	apiCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ecsip_aws_api_calls_total",
+		Help: "AWS API calls by service and operation, every retry attempt is counted.",
+	}, []string{"service", "operation"})
+	apiErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ecsip_aws_api_errors_total",
+		Help: "Failed AWS API calls by service and operation, including throttled ones.",
+	}, []string{"service", "operation"})
+	apiThrottles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ecsip_aws_api_throttles_total",
+		Help: "Throttled AWS API calls by service and operation.",
+	}, []string{"service", "operation"})
+)
+
+// apiMetrics adds the middleware counting AWS API calls, it is added after the retry middleware to see every attempt
+func apiMetrics(stack *middleware.Stack) error {
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("ApiMetrics", func(
+		ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+	) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+		out, metadata, err := next.HandleFinalize(ctx, in)
+
+		apiCalls.WithLabelValues(service, operation).Inc()
+		if err != nil {
+			apiErrors.WithLabelValues(service, operation).Inc()
+			if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err).Bool() {
+				apiThrottles.WithLabelValues(service, operation).Inc()
+			}
+		}
+		return out, metadata, err
+	}), middleware.After)
+}
@@ -1,5 +1,12 @@
 package aws
 
+import "net/netip"
+
+var mockAddresses = []Address{
+	{IP: netip.MustParseAddr("127.0.0.1"), Kind: AddressPrivate},
+	{IP: netip.MustParseAddr("8.9.8.8"), Kind: AddressPublic},
+}
+
 // MockClusters returns a list of mocked clusters. This function is used for testing purposes.
 func (store *Store) MockClusters() []Cluster {
 	res := []Cluster{
@@ -8,16 +15,14 @@ func (store *Store) MockClusters() []Cluster {
 			Name: "default",
 			Services: []Service{
 				{
-					Name:       "web",
-					Image:      "nginx:latest",
-					PrivateIPs: []string{"127.0.0.1"},
-					PublicIPs:  []string{"8.9.8.8"},
+					Name:      "web",
+					Image:     "nginx:latest",
+					Addresses: mockAddresses,
 				},
 				{
-					Name:       "db",
-					Image:      "nginx:latest",
-					PrivateIPs: []string{"127.0.0.1"},
-					PublicIPs:  []string{"8.9.8.8"},
+					Name:      "db",
+					Image:     "nginx:latest",
+					Addresses: mockAddresses,
 				},
 			},
 		},
@@ -26,16 +31,14 @@ func (store *Store) MockClusters() []Cluster {
 			Name: "prod",
 			Services: []Service{
 				{
-					Name:       "web",
-					Image:      "nginx:latest",
-					PrivateIPs: []string{"127.0.0.1"},
-					PublicIPs:  []string{"8.9.8.8"},
+					Name:      "web",
+					Image:     "nginx:latest",
+					Addresses: mockAddresses,
 				},
 				{
-					Name:       "db",
-					Image:      "nginx:latest",
-					PrivateIPs: []string{"127.0.0.1"},
-					PublicIPs:  []string{"8.9.8.8"},
+					Name:      "db",
+					Image:     "nginx:latest",
+					Addresses: mockAddresses,
 				},
 			},
 		},
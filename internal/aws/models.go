@@ -1,19 +1,278 @@
 package aws
 
+import (
+	"net/netip"
+	"slices"
+)
+
 type Cluster struct {
-	Arn      string
-	Name     string
-	Services []Service
+	Arn      string    `json:"arn"`
+	Name     string    `json:"name"`
+	Region   string    `json:"region"`
+	Account  string    `json:"account"`
+	Services []Service `json:"services"`
+	// TaskGroups are running tasks which do not belong to any service, e.g. started by RunTask or by a schedule
+	TaskGroups []TaskGroup `json:"taskGroups"`
+	// Hosts are all container instances registered in the cluster, including those without tasks
+	Hosts []Host `json:"hosts"`
+	// Vpcs are VPCs where addresses of the cluster live
+	Vpcs []Vpc `json:"vpcs"`
+}
+
+// Addresses returns addresses of all services, standalone tasks and hosts of the cluster
+func (cluster Cluster) Addresses() []Address {
+	res := []Address{}
+	for _, service := range cluster.Services {
+		res = append(res, service.Addresses...)
+	}
+	for _, group := range cluster.TaskGroups {
+		for _, task := range group.Tasks {
+			res = append(res, task.Addresses...)
+		}
+	}
+	for _, host := range cluster.Hosts {
+		res = append(res, host.Addresses...)
+	}
+	return res
+}
+
+func (cluster Cluster) vpcIDs() []string {
+	res := []string{}
+	for _, address := range cluster.Addresses() {
+		if address.VpcID != "" && !slices.Contains(res, address.VpcID) {
+			res = append(res, address.VpcID)
+		}
+	}
+	return res
+}
+
+// Vpc is a VPC with its connections to other VPCs
+type Vpc struct {
+	ID      string         `json:"id"`
+	Name    string         `json:"name"`
+	Account string         `json:"account"`
+	Region  string         `json:"region"`
+	CIDRs   []netip.Prefix `json:"cidrs"`
+	// Peerings are active peering connections of the VPC
+	Peerings []VpcPeering `json:"peerings"`
+	// TransitGateways are IDs of transit gateways the VPC is attached to
+	TransitGateways []string `json:"transitGateways"`
+}
+
+// VpcPeering describes the VPC on the other side of a peering connection, it may be outside of the crawled inventory
+type VpcPeering struct {
+	ID      string         `json:"id"`
+	VpcID   string         `json:"vpcId"`
+	Account string         `json:"account"`
+	Region  string         `json:"region"`
+	CIDRs   []netip.Prefix `json:"cidrs"`
+}
+
+// TaskGroup is a set of standalone tasks with the same group and the same starter
+type TaskGroup struct {
+	Group     string `json:"group"`
+	StartedBy string `json:"startedBy"`
+	Tasks     []Task `json:"tasks"`
 }
 
 type Service struct {
-	Name       string
-	Image      string
-	App        string
-	Env        string
-	Component  string
-	Container  string
-	Version    string
-	PrivateIPs []string
-	PublicIPs  []string
+	Name           string         `json:"name"`
+	Image          string         `json:"image"`
+	App            string         `json:"app"`
+	Env            string         `json:"env"`
+	Component      string         `json:"component"`
+	Container      string         `json:"container"`
+	Version        string         `json:"version"`
+	Addresses      []Address      `json:"addresses"`
+	TaskDefinition TaskDefinition `json:"taskDefinition"`
+	// LaunchType is empty when the service uses a capacity provider strategy
+	LaunchType        string             `json:"launchType"`
+	CapacityProviders []CapacityProvider `json:"capacityProviders"`
+	PlatformVersion   string             `json:"platformVersion"`
+	Tasks             []Task             `json:"tasks"`
+	DesiredCount      int32              `json:"desiredCount"`
+	RunningCount      int32              `json:"runningCount"`
+	PendingCount      int32              `json:"pendingCount"`
+	// RolloutState is the state of the primary deployment: IN_PROGRESS, COMPLETED or FAILED
+	RolloutState string `json:"rolloutState"`
+}
+
+// Spot reports whether the service can be interrupted, either because of the FARGATE_SPOT capacity provider
+// or because some of its tasks run on spot instances
+func (service Service) Spot() bool {
+	for _, provider := range service.CapacityProviders {
+		if provider.Name == FargateSpot {
+			return true
+		}
+	}
+	return service.SpotTasks() > 0
+}
+
+func (service Service) PrivateIPs() []string {
+	return AddressStrings(service.Addresses, AddressPrivate)
+}
+
+func (service Service) PublicIPs() []string {
+	return AddressStrings(service.Addresses, AddressPublic, AddressElastic)
+}
+
+func (service Service) IPv6s() []string {
+	return AddressStrings(service.Addresses, AddressIPv6)
+}
+
+// Hosts returns unique hosts the service tasks are placed on
+func (service Service) Hosts() []Host {
+	res := []Host{}
+	for _, task := range service.Tasks {
+		if task.Host != nil && !slices.ContainsFunc(res, func(host Host) bool { return host.ID == task.Host.ID }) {
+			res = append(res, *task.Host)
+		}
+	}
+	return res
+}
+
+func (service Service) SpotTasks() int {
+	res := 0
+	for _, task := range service.Tasks {
+		if task.Spot {
+			res++
+		}
+	}
+	return res
+}
+
+// FargateSpot is the name of the built-in capacity provider for Fargate Spot
+const FargateSpot = "FARGATE_SPOT"
+
+type CapacityProvider struct {
+	Name   string `json:"name"`
+	Weight int32  `json:"weight"`
+	Base   int32  `json:"base"`
+}
+
+type Task struct {
+	Arn              string `json:"arn"`
+	Group            string `json:"group"`
+	StartedBy        string `json:"startedBy"`
+	LaunchType       string `json:"launchType"`
+	CapacityProvider string `json:"capacityProvider"`
+	PlatformVersion  string `json:"platformVersion"`
+	// Spot is set for tasks running on FARGATE_SPOT or on a spot EC2 instance
+	Spot       bool     `json:"spot"`
+	Containers []string `json:"containers"`
+	// Addresses are addresses of the task network interface for awsvpc network mode, otherwise addresses of the host
+	Addresses []Address `json:"addresses"`
+	// Host is nil for Fargate tasks
+	Host *Host `json:"host,omitempty"`
+	// Bindings are host ports of containers in bridge and host network modes,
+	// tasks with awsvpc network mode have none as containers listen on the task addresses
+	Bindings []PortBinding `json:"bindings"`
+}
+
+// HostPort returns the port the container port is reachable on at the task addresses
+func (task Task) HostPort(container string, containerPort int32) int32 {
+	for _, binding := range task.Bindings {
+		if binding.Container == container && binding.ContainerPort == containerPort {
+			return binding.HostPort
+		}
+	}
+	return containerPort
+}
+
+type PortBinding struct {
+	Container     string `json:"container"`
+	ContainerPort int32  `json:"containerPort"`
+	HostPort      int32  `json:"hostPort"`
+	Protocol      string `json:"protocol"`
+}
+
+func (task Task) PrivateIPs() []string {
+	return AddressStrings(task.Addresses, AddressPrivate)
+}
+
+func (task Task) PublicIPs() []string {
+	return AddressStrings(task.Addresses, AddressPublic, AddressElastic)
+}
+
+func (task Task) IPv6s() []string {
+	return AddressStrings(task.Addresses, AddressIPv6)
+}
+
+// Host is the EC2 instance or the ECS Anywhere external instance the task is placed on
+type Host struct {
+	// ID is EC2 instance ID or Systems Manager managed instance ID for external instances
+	ID        string    `json:"id"`
+	Hostname  string    `json:"hostname"`
+	Addresses []Address `json:"addresses"`
+	External  bool      `json:"external"`
+	Spot      bool      `json:"spot"`
+}
+
+type AddressKind string
+
+const (
+	AddressPrivate AddressKind = "private"
+	// AddressPublic is a public address auto-assigned by AWS, it changes when the instance is stopped
+	AddressPublic  AddressKind = "public"
+	AddressElastic AddressKind = "elastic"
+	AddressIPv6    AddressKind = "ipv6"
+)
+
+// Address is an IP address with its network placement, network fields are empty for external instances
+type Address struct {
+	IP               netip.Addr   `json:"ip"`
+	Kind             AddressKind  `json:"kind"`
+	VpcID            string       `json:"vpcId"`
+	VpcName          string       `json:"vpcName"`
+	SubnetID         string       `json:"subnetId"`
+	SubnetName       string       `json:"subnetName"`
+	SubnetCIDR       netip.Prefix `json:"subnetCidr"`
+	AvailabilityZone string       `json:"availabilityZone"`
+	EniID            string       `json:"eniId"`
+}
+
+func (address Address) Public() bool {
+	return address.Kind == AddressPublic || address.Kind == AddressElastic
+}
+
+// AddressStrings returns addresses of the given kinds as strings
+func AddressStrings(addresses []Address, kinds ...AddressKind) []string {
+	res := []string{}
+	for _, address := range addresses {
+		if slices.Contains(kinds, address.Kind) {
+			res = append(res, address.IP.String())
+		}
+	}
+	return res
+}
+
+type TaskDefinition struct {
+	Arn        string                `json:"arn"`
+	Family     string                `json:"family"`
+	Revision   int32                 `json:"revision"`
+	Cpu        string                `json:"cpu"`
+	Memory     string                `json:"memory"`
+	Containers []ContainerDefinition `json:"containers"`
+}
+
+// ContainerDefinition keeps only the parts of the container definition which are useful for comparison,
+// environment variables are stored by name only to avoid exposing their values.
+type ContainerDefinition struct {
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	Version      string            `json:"version"`
+	Cpu          int32             `json:"cpu"`
+	Memory       int32             `json:"memory"`
+	Environment  []string          `json:"environment"`
+	Secrets      map[string]string `json:"secrets"`
+	PortMappings []PortMapping     `json:"portMappings"`
+	LogDriver    string            `json:"logDriver"`
+	LogOptions   map[string]string `json:"logOptions"`
+	DockerLabels map[string]string `json:"dockerLabels"`
+}
+
+type PortMapping struct {
+	ContainerPort int32  `json:"containerPort"`
+	HostPort      int32  `json:"hostPort"`
+	Protocol      string `json:"protocol"`
 }
@@ -0,0 +1,340 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/samber/lo"
+)
+
+// networkInterface is the common part of EC2 instance network interface and standalone network interface
+type networkInterface struct {
+	id        string
+	vpcID     string
+	subnetID  string
+	addresses []interfaceAddress
+	ipv6      []*string
+}
+
+type interfaceAddress struct {
+	private *string
+	public  *string
+	ipOwner *string
+}
+
+func instanceNetworkInterfaces(instance ec2Types.Instance) []networkInterface {
+	res := lo.Map(instance.NetworkInterfaces, func(eni ec2Types.InstanceNetworkInterface, _ int) networkInterface {
+		return networkInterface{
+			id:       lo.FromPtr(eni.NetworkInterfaceId),
+			vpcID:    lo.FromPtr(eni.VpcId),
+			subnetID: lo.FromPtr(eni.SubnetId),
+			addresses: lo.Map(eni.PrivateIpAddresses, func(ip ec2Types.InstancePrivateIpAddress, _ int) interfaceAddress {
+				res := interfaceAddress{private: ip.PrivateIpAddress}
+				if ip.Association != nil {
+					res.public, res.ipOwner = ip.Association.PublicIp, ip.Association.IpOwnerId
+				}
+				return res
+			}),
+			ipv6: lo.Map(eni.Ipv6Addresses, func(ip ec2Types.InstanceIpv6Address, _ int) *string {
+				return ip.Ipv6Address
+			}),
+		}
+	})
+	// network interfaces may be missing in the response, fall back to the primary addresses of the instance
+	if len(res) == 0 {
+		res = append(res, networkInterface{
+			vpcID:     lo.FromPtr(instance.VpcId),
+			subnetID:  lo.FromPtr(instance.SubnetId),
+			addresses: []interfaceAddress{{private: instance.PrivateIpAddress, public: instance.PublicIpAddress}},
+			ipv6:      []*string{instance.Ipv6Address},
+		})
+	}
+	return res
+}
+
+func taskNetworkInterface(eni ec2Types.NetworkInterface) networkInterface {
+	return networkInterface{
+		id:       lo.FromPtr(eni.NetworkInterfaceId),
+		vpcID:    lo.FromPtr(eni.VpcId),
+		subnetID: lo.FromPtr(eni.SubnetId),
+		addresses: lo.Map(eni.PrivateIpAddresses, func(ip ec2Types.NetworkInterfacePrivateIpAddress, _ int) interfaceAddress {
+			res := interfaceAddress{private: ip.PrivateIpAddress}
+			if ip.Association != nil {
+				res.public, res.ipOwner = ip.Association.PublicIp, ip.Association.IpOwnerId
+			}
+			return res
+		}),
+		ipv6: lo.Map(eni.Ipv6Addresses, func(ip ec2Types.NetworkInterfaceIpv6Address, _ int) *string {
+			return ip.Ipv6Address
+		}),
+	}
+}
+
+// network holds subnets and VPCs of network interfaces keyed by their IDs
+type network struct {
+	subnets map[string]ec2Types.Subnet
+	vpcs    map[string]ec2Types.Vpc
+}
+
+// addresses converts network interfaces to addresses, network is used to fill subnet and VPC details
+func addresses(interfaces []networkInterface, net network) []Address {
+	res := []Address{}
+	for _, eni := range interfaces {
+		base := Address{
+			VpcID:    eni.vpcID,
+			SubnetID: eni.subnetID,
+			EniID:    eni.id,
+		}
+		if subnet, ok := net.subnets[eni.subnetID]; ok {
+			base.SubnetCIDR, _ = netip.ParsePrefix(lo.FromPtr(subnet.CidrBlock))
+			base.SubnetName = nameTag(subnet.Tags)
+			base.AvailabilityZone = lo.FromPtr(subnet.AvailabilityZone)
+		}
+		if vpc, ok := net.vpcs[eni.vpcID]; ok {
+			base.VpcName = nameTag(vpc.Tags)
+		}
+		for _, ip := range eni.addresses {
+			if address, ok := parseAddress(ip.private, AddressPrivate, base); ok {
+				res = append(res, address)
+			}
+			// public addresses owned by amazon are auto-assigned, otherwise it is an Elastic IP of the account
+			kind := AddressElastic
+			if ip.ipOwner == nil || *ip.ipOwner == "amazon" {
+				kind = AddressPublic
+			}
+			if address, ok := parseAddress(ip.public, kind, base); ok {
+				// public address lives outside of the subnet
+				address.SubnetCIDR = netip.Prefix{}
+				res = append(res, address)
+			}
+		}
+		for _, ip := range eni.ipv6 {
+			if address, ok := parseAddress(ip, AddressIPv6, base); ok {
+				address.SubnetCIDR = subnetIPv6CIDR(net.subnets[eni.subnetID], address.IP)
+				res = append(res, address)
+			}
+		}
+	}
+	return res
+}
+
+// subnetIPv6CIDR returns the IPv6 CIDR block of the subnet which contains the address
+func subnetIPv6CIDR(subnet ec2Types.Subnet, ip netip.Addr) netip.Prefix {
+	for _, association := range subnet.Ipv6CidrBlockAssociationSet {
+		prefix, err := netip.ParsePrefix(lo.FromPtr(association.Ipv6CidrBlock))
+		if err == nil && prefix.Contains(ip) {
+			return prefix
+		}
+	}
+	return netip.Prefix{}
+}
+
+func nameTag(tags []ec2Types.Tag) string {
+	for _, tag := range tags {
+		if lo.FromPtr(tag.Key) == "Name" {
+			return lo.FromPtr(tag.Value)
+		}
+	}
+	return ""
+}
+
+// parseAddress returns false when the address is absent or invalid
+func parseAddress(ip *string, kind AddressKind, base Address) (Address, bool) {
+	if ip == nil || *ip == "" {
+		return Address{}, false
+	}
+	addr, err := netip.ParseAddr(*ip)
+	if err != nil {
+		log.Printf("invalid IP address %q: %v", *ip, err)
+		return Address{}, false
+	}
+	base.IP = addr
+	base.Kind = kind
+	return base, true
+}
+
+// networkInterfaces describes task network interfaces, the result is keyed by network interface ID.
+// Interfaces of stopping tasks may be already deleted, the filter skips them while NetworkInterfaceIds
+// would fail the whole call with InvalidNetworkInterfaceID.NotFound.
+func (store *Store) networkInterfaces(ids []string) (map[string]ec2Types.NetworkInterface, error) {
+	res := map[string]ec2Types.NetworkInterface{}
+	// filters take at most 200 values
+	for _, chunk := range lo.Chunk(ids, 200) {
+		paginator := ec2.NewDescribeNetworkInterfacesPaginator(store.ec2Client, &ec2.DescribeNetworkInterfacesInput{
+			Filters: []ec2Types.Filter{{Name: lo.ToPtr("network-interface-id"), Values: chunk}},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(context.TODO())
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe network interfaces: %w", err)
+			}
+			for _, eni := range page.NetworkInterfaces {
+				res[*eni.NetworkInterfaceId] = eni
+			}
+		}
+	}
+	return res, nil
+}
+
+// network describes subnets and VPCs of the network interfaces, they only name the networks of addresses,
+// so addresses are kept without names when they cannot be read
+func (store *Store) network(interfaces []networkInterface) network {
+	res := network{
+		subnets: map[string]ec2Types.Subnet{},
+		vpcs:    map[string]ec2Types.Vpc{},
+	}
+	subnetIDs := lo.Uniq(lo.FilterMap(interfaces, func(eni networkInterface, _ int) (string, bool) {
+		return eni.subnetID, eni.subnetID != ""
+	}))
+	if len(subnetIDs) > 0 {
+		output, err := store.ec2Client.DescribeSubnets(context.TODO(), &ec2.DescribeSubnetsInput{
+			SubnetIds: subnetIDs,
+		})
+		if err != nil {
+			log.Printf("warning: failed to describe subnets: %v", err)
+		} else {
+			for _, subnet := range output.Subnets {
+				res.subnets[*subnet.SubnetId] = subnet
+			}
+		}
+	}
+
+	vpcIDs := lo.Uniq(lo.FilterMap(interfaces, func(eni networkInterface, _ int) (string, bool) {
+		return eni.vpcID, eni.vpcID != ""
+	}))
+	if len(vpcIDs) > 0 {
+		output, err := store.ec2Client.DescribeVpcs(context.TODO(), &ec2.DescribeVpcsInput{
+			VpcIds: vpcIDs,
+		})
+		if err != nil {
+			log.Printf("warning: failed to describe VPCs: %v", err)
+		} else {
+			for _, vpc := range output.Vpcs {
+				res.vpcs[*vpc.VpcId] = vpc
+			}
+		}
+	}
+	return res
+}
+
+// vpcs describes VPCs with their CIDRs, active peering connections and transit gateway attachments
+func (store *Store) vpcs(ids []string) ([]Vpc, error) {
+	res := []Vpc{}
+	if len(ids) == 0 {
+		return res, nil
+	}
+	output, err := store.ec2Client.DescribeVpcs(context.TODO(), &ec2.DescribeVpcsInput{
+		VpcIds: ids,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe VPCs: %w", err)
+	}
+
+	// connections only widen collision detection, VPCs are kept without them
+	peerings, err := store.vpcPeerings(ids)
+	if err != nil {
+		log.Printf("warning: %v", err)
+	}
+	transitGateways, err := store.transitGateways(ids)
+	if err != nil {
+		log.Printf("warning: %v", err)
+	}
+
+	for _, vpc := range output.Vpcs {
+		cidrs := lo.Map(vpc.CidrBlockAssociationSet, func(association ec2Types.VpcCidrBlockAssociation, _ int) *string {
+			return association.CidrBlock
+		})
+		cidrs = append(cidrs, lo.Map(vpc.Ipv6CidrBlockAssociationSet, func(association ec2Types.VpcIpv6CidrBlockAssociation, _ int) *string {
+			return association.Ipv6CidrBlock
+		})...)
+		res = append(res, Vpc{
+			ID:              *vpc.VpcId,
+			Name:            nameTag(vpc.Tags),
+			Account:         lo.FromPtr(vpc.OwnerId),
+			Region:          store.region,
+			CIDRs:           parsePrefixes(cidrs),
+			Peerings:        peerings[*vpc.VpcId],
+			TransitGateways: transitGateways[*vpc.VpcId],
+		})
+	}
+	return res, nil
+}
+
+// vpcPeerings returns active peering connections keyed by VPC ID, the VPC may be on any side of the connection
+func (store *Store) vpcPeerings(ids []string) (map[string][]VpcPeering, error) {
+	res := map[string][]VpcPeering{}
+	for _, side := range []string{"requester-vpc-info.vpc-id", "accepter-vpc-info.vpc-id"} {
+		paginator := ec2.NewDescribeVpcPeeringConnectionsPaginator(store.ec2Client, &ec2.DescribeVpcPeeringConnectionsInput{
+			Filters: []ec2Types.Filter{
+				{Name: lo.ToPtr(side), Values: ids},
+				{Name: lo.ToPtr("status-code"), Values: []string{string(ec2Types.VpcPeeringConnectionStateReasonCodeActive)}},
+			},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(context.TODO())
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe VPC peering connections: %w", err)
+			}
+			for _, connection := range page.VpcPeeringConnections {
+				local, remote := connection.RequesterVpcInfo, connection.AccepterVpcInfo
+				if side == "accepter-vpc-info.vpc-id" {
+					local, remote = remote, local
+				}
+				if local == nil || remote == nil {
+					continue
+				}
+				cidrs := lo.Map(remote.CidrBlockSet, func(block ec2Types.CidrBlock, _ int) *string {
+					return block.CidrBlock
+				})
+				cidrs = append(cidrs, lo.Map(remote.Ipv6CidrBlockSet, func(block ec2Types.Ipv6CidrBlock, _ int) *string {
+					return block.Ipv6CidrBlock
+				})...)
+				res[lo.FromPtr(local.VpcId)] = append(res[lo.FromPtr(local.VpcId)], VpcPeering{
+					ID:      lo.FromPtr(connection.VpcPeeringConnectionId),
+					VpcID:   lo.FromPtr(remote.VpcId),
+					Account: lo.FromPtr(remote.OwnerId),
+					Region:  lo.FromPtr(remote.Region),
+					CIDRs:   parsePrefixes(cidrs),
+				})
+			}
+		}
+	}
+	return res, nil
+}
+
+// transitGateways returns IDs of transit gateways keyed by attached VPC ID
+func (store *Store) transitGateways(ids []string) (map[string][]string, error) {
+	res := map[string][]string{}
+	paginator := ec2.NewDescribeTransitGatewayAttachmentsPaginator(store.ec2Client, &ec2.DescribeTransitGatewayAttachmentsInput{
+		Filters: []ec2Types.Filter{
+			{Name: lo.ToPtr("resource-id"), Values: ids},
+			{Name: lo.ToPtr("resource-type"), Values: []string{string(ec2Types.TransitGatewayAttachmentResourceTypeVpc)}},
+			{Name: lo.ToPtr("state"), Values: []string{string(ec2Types.TransitGatewayAttachmentStateAvailable)}},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe transit gateway attachments: %w", err)
+		}
+		for _, attachment := range page.TransitGatewayAttachments {
+			vpcID := lo.FromPtr(attachment.ResourceId)
+			res[vpcID] = lo.Uniq(append(res[vpcID], lo.FromPtr(attachment.TransitGatewayId)))
+		}
+	}
+	return res, nil
+}
+
+func parsePrefixes(cidrs []*string) []netip.Prefix {
+	res := []netip.Prefix{}
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(lo.FromPtr(cidr)); err == nil {
+			res = append(res, prefix)
+		}
+	}
+	return res
+}
@@ -5,32 +5,44 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/samber/lo"
 
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go/middleware"
 )
 
 type Store struct {
+	region    string
 	ecsClient *ecs.Client
 	ec2Client *ec2.Client
+	ssmClient *ssm.Client
 }
 
 func NewStore(region string) *Store {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion(region),
+		config.WithAPIOptions([]func(*middleware.Stack) error{apiMetrics}),
+	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	return &Store{
+		region:    region,
 		ecsClient: ecs.NewFromConfig(cfg),
 		ec2Client: ec2.NewFromConfig(cfg),
+		ssmClient: ssm.NewFromConfig(cfg),
 	}
 }
 
@@ -77,11 +89,116 @@ func (store *Store) Clusters() []Cluster {
 func (store *Store) clusterDetails(cl ecsTypes.Cluster, wg *sync.WaitGroup, ch chan Cluster) {
 	defer wg.Done()
 
-	ch <- Cluster{
-		Arn:      *cl.ClusterArn,
-		Name:     *cl.ClusterName,
-		Services: store.services(cl),
+	services := store.services(cl)
+	res := Cluster{
+		Arn:        *cl.ClusterArn,
+		Name:       *cl.ClusterName,
+		Services:   services,
+		TaskGroups: store.standaloneTasks(cl, services),
+		Hosts:      store.clusterHosts(cl),
 	}
+	if clusterArn, err := arn.Parse(*cl.ClusterArn); err == nil {
+		res.Region = clusterArn.Region
+		res.Account = clusterArn.AccountID
+	}
+
+	// VPC details only enrich the analysis, the cluster is still listed when they cannot be read
+	vpcs, err := store.vpcs(res.vpcIDs())
+	if err != nil {
+		log.Printf("warning: cluster %s has no VPC details: %v", res.Name, err)
+		vpcs = []Vpc{}
+	}
+	res.Vpcs = vpcs
+	ch <- res
+}
+
+// clusterHosts returns all container instances of the cluster
+func (store *Store) clusterHosts(c ecsTypes.Cluster) []Host {
+	var containerInstanceArns []string
+	paginator := ecs.NewListContainerInstancesPaginator(store.ecsClient, &ecs.ListContainerInstancesInput{
+		Cluster: c.ClusterArn,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Fatal(err)
+		}
+		containerInstanceArns = append(containerInstanceArns, page.ContainerInstanceArns...)
+	}
+
+	res := []Host{}
+	// DescribeContainerInstances accepts up to 100 container instances at once
+	for _, chunk := range lo.Chunk(containerInstanceArns, 100) {
+		hosts, err := store.hosts(c.ClusterArn, chunk)
+		if err != nil {
+			log.Fatal(err)
+		}
+		res = append(res, lo.Values(hosts)...)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// standaloneTasks returns running tasks of the cluster which are not started by a service, grouped by group and starter.
+// Tasks of the services are already described, ListTasks returns them too but without group, so they are skipped by ARN.
+func (store *Store) standaloneTasks(c ecsTypes.Cluster, services []Service) []TaskGroup {
+	res := []TaskGroup{}
+	serviceTaskArns := map[string]bool{}
+	for _, service := range services {
+		for _, task := range service.Tasks {
+			serviceTaskArns[task.Arn] = true
+		}
+	}
+	var taskArns []string
+	paginator := ecs.NewListTasksPaginator(store.ecsClient, &ecs.ListTasksInput{
+		Cluster:       c.ClusterArn,
+		DesiredStatus: ecsTypes.DesiredStatusRunning,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, taskArn := range page.TaskArns {
+			if !serviceTaskArns[taskArn] {
+				taskArns = append(taskArns, taskArn)
+			}
+		}
+	}
+
+	// DescribeTasks accepts up to 100 tasks at once
+	for _, chunk := range lo.Chunk(taskArns, 100) {
+		output, err := store.ecsClient.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
+			Cluster: c.ClusterArn,
+			Tasks:   chunk,
+		})
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to describe tasks for cluster %v: %w", *c.ClusterArn, err))
+		}
+		// tasks started by a service after the service was described, they are listed with the service on the next crawl
+		standalone := lo.Filter(output.Tasks, func(task ecsTypes.Task, _ int) bool {
+			return !strings.HasPrefix(lo.FromPtr(task.Group), "service:")
+		})
+		if len(standalone) == 0 {
+			continue
+		}
+		tasks, err := store.tasks(c.ClusterArn, standalone)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, task := range tasks {
+			_, index, found := lo.FindIndexOf(res, func(group TaskGroup) bool {
+				return group.Group == task.Group && group.StartedBy == task.StartedBy
+			})
+			if !found {
+				res = append(res, TaskGroup{Group: task.Group, StartedBy: task.StartedBy})
+				index = len(res) - 1
+			}
+			res[index].Tasks = append(res[index].Tasks, task)
+		}
+	}
+
+	return res
 }
 
 func (store *Store) services(c ecsTypes.Cluster) []Service {
@@ -188,35 +305,175 @@ func findAndCut(input string, values []string) (string, string) {
 
 func (store *Store) serviceDetails(service ecsTypes.Service, wg *sync.WaitGroup, ch chan Service) {
 	defer wg.Done()
-	instances, err := store.serviceInstances(service)
+	tasks, err := store.serviceTasks(service)
 	if err != nil {
 		log.Fatal(err)
 	}
-	ch <- Service{
-		Name:  *service.ServiceName,
-		Image: store.appImage(service),
-		PrivateIPs: lo.Map(instances, func(instance ec2Types.Instance, _ int) string {
-			return *instance.PrivateIpAddress
+	taskDefinition := store.taskDefinition(service)
+	res := Service{
+		Name: *service.ServiceName,
+		// we assume that there is only one container in the task definition or at least the first one is the one we are interested in
+		Image:          taskDefinition.Containers[0].Image,
+		TaskDefinition: taskDefinition,
+		LaunchType:     string(service.LaunchType),
+		CapacityProviders: lo.Map(service.CapacityProviderStrategy, func(item ecsTypes.CapacityProviderStrategyItem, _ int) CapacityProvider {
+			return CapacityProvider{
+				Name:   lo.FromPtr(item.CapacityProvider),
+				Weight: item.Weight,
+				Base:   item.Base,
+			}
 		}),
-		PublicIPs: lo.Map(instances, func(instance ec2Types.Instance, _ int) string {
-			return *instance.PublicIpAddress
+		PlatformVersion: lo.FromPtr(service.PlatformVersion),
+		Tasks:           tasks,
+		Addresses:       []Address{},
+		DesiredCount:    service.DesiredCount,
+		RunningCount:    service.RunningCount,
+		PendingCount:    service.PendingCount,
+	}
+	for _, deployment := range service.Deployments {
+		if lo.FromPtr(deployment.Status) == "PRIMARY" {
+			res.RolloutState = string(deployment.RolloutState)
+		}
+	}
+	// several tasks may share the same host
+	for _, task := range tasks {
+		for _, address := range task.Addresses {
+			if !lo.ContainsBy(res.Addresses, func(a Address) bool { return a.IP == address.IP }) {
+				res.Addresses = append(res.Addresses, address)
+			}
+		}
+	}
+	ch <- res
+}
+
+func taskDetails(task ecsTypes.Task, hosts map[string]Host, interfaces map[string][]Address) Task {
+	res := Task{
+		Arn:              *task.TaskArn,
+		Group:            lo.FromPtr(task.Group),
+		StartedBy:        lo.FromPtr(task.StartedBy),
+		LaunchType:       string(task.LaunchType),
+		CapacityProvider: lo.FromPtr(task.CapacityProviderName),
+		PlatformVersion:  lo.FromPtr(task.PlatformVersion),
+		Spot:             lo.FromPtr(task.CapacityProviderName) == FargateSpot,
+		Containers: lo.Map(task.Containers, func(container ecsTypes.Container, _ int) string {
+			return lo.FromPtr(container.Name)
 		}),
+		Addresses: []Address{},
+		Bindings:  []PortBinding{},
 	}
+	for _, container := range task.Containers {
+		for _, binding := range container.NetworkBindings {
+			res.Bindings = append(res.Bindings, PortBinding{
+				Container:     lo.FromPtr(container.Name),
+				ContainerPort: lo.FromPtr(binding.ContainerPort),
+				HostPort:      lo.FromPtr(binding.HostPort),
+				Protocol:      string(binding.Protocol),
+			})
+		}
+	}
+	if host, ok := hosts[lo.FromPtr(task.ContainerInstanceArn)]; ok {
+		res.Host = &host
+		res.Spot = res.Spot || host.Spot
+	}
+
+	// tasks with awsvpc network mode have their own network interface
+	if eniID, ok := attachmentDetail(task, "networkInterfaceId"); ok {
+		if addresses, ok := interfaces[eniID]; ok {
+			res.Addresses = addresses
+		} else {
+			// the network interface is already deleted, only private addresses are known from the attachment
+			if privateIP, ok := attachmentDetail(task, "privateIPv4Address"); ok {
+				if address, ok := parseAddress(&privateIP, AddressPrivate, Address{EniID: eniID}); ok {
+					res.Addresses = append(res.Addresses, address)
+				}
+			}
+			if ipv6, ok := attachmentDetail(task, "ipv6Address"); ok {
+				if address, ok := parseAddress(&ipv6, AddressIPv6, Address{EniID: eniID}); ok {
+					res.Addresses = append(res.Addresses, address)
+				}
+			}
+		}
+	} else if res.Host != nil {
+		res.Addresses = res.Host.Addresses
+	}
+	return res
 }
 
-func (store *Store) appImage(service ecsTypes.Service) string {
-	taskDefinition, err := store.ecsClient.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
+// attachmentDetail returns value of the elastic network interface attachment detail
+func attachmentDetail(task ecsTypes.Task, name string) (string, bool) {
+	for _, attachment := range task.Attachments {
+		if lo.FromPtr(attachment.Type) != "ElasticNetworkInterface" {
+			continue
+		}
+		for _, detail := range attachment.Details {
+			if lo.FromPtr(detail.Name) == name {
+				return lo.FromPtr(detail.Value), true
+			}
+		}
+	}
+	return "", false
+}
+
+func (store *Store) taskDefinition(service ecsTypes.Service) TaskDefinition {
+	output, err := store.ecsClient.DescribeTaskDefinition(context.TODO(), &ecs.DescribeTaskDefinitionInput{
 		TaskDefinition: service.TaskDefinition,
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// we assume that there is only one container in the task definition or at least the first one is the one we are interested in
-	return *taskDefinition.TaskDefinition.ContainerDefinitions[0].Image
+	taskDefinition := output.TaskDefinition
+	return TaskDefinition{
+		Arn:        *taskDefinition.TaskDefinitionArn,
+		Family:     lo.FromPtr(taskDefinition.Family),
+		Revision:   taskDefinition.Revision,
+		Cpu:        lo.FromPtr(taskDefinition.Cpu),
+		Memory:     lo.FromPtr(taskDefinition.Memory),
+		Containers: lo.Map(taskDefinition.ContainerDefinitions, containerDefinition),
+	}
+}
+
+func containerDefinition(container ecsTypes.ContainerDefinition, _ int) ContainerDefinition {
+	res := ContainerDefinition{
+		Name:    lo.FromPtr(container.Name),
+		Image:   lo.FromPtr(container.Image),
+		Version: imageTag(lo.FromPtr(container.Image)),
+		Cpu:     container.Cpu,
+		Memory:  lo.FromPtr(container.Memory),
+		Environment: lo.Map(container.Environment, func(variable ecsTypes.KeyValuePair, _ int) string {
+			return lo.FromPtr(variable.Name)
+		}),
+		Secrets: lo.SliceToMap(container.Secrets, func(secret ecsTypes.Secret) (string, string) {
+			return lo.FromPtr(secret.Name), lo.FromPtr(secret.ValueFrom)
+		}),
+		PortMappings: lo.Map(container.PortMappings, func(mapping ecsTypes.PortMapping, _ int) PortMapping {
+			return PortMapping{
+				ContainerPort: lo.FromPtr(mapping.ContainerPort),
+				HostPort:      lo.FromPtr(mapping.HostPort),
+				Protocol:      string(mapping.Protocol),
+			}
+		}),
+	}
+	res.DockerLabels = container.DockerLabels
+	if container.LogConfiguration != nil {
+		res.LogDriver = string(container.LogConfiguration.LogDriver)
+		res.LogOptions = container.LogConfiguration.Options
+	}
+	return res
+}
+
+// imageTag returns the tag part of the image name, it is the version of the application in our naming convention
+func imageTag(image string) string {
+	// strip the registry part first, it may contain a port separated by colon
+	name := image[strings.LastIndex(image, "/")+1:]
+	if _, tag, found := strings.Cut(name, ":"); found {
+		return tag
+	}
+	return ""
 }
 
-func (store *Store) serviceInstances(service ecsTypes.Service) ([]ec2Types.Instance, error) {
+// serviceTasks returns running tasks of the service
+func (store *Store) serviceTasks(service ecsTypes.Service) ([]Task, error) {
 	// List the tasks running in the service
 	taskList, err := store.ecsClient.ListTasks(context.TODO(), &ecs.ListTasksInput{
 		Cluster:     service.ClusterArn,
@@ -230,60 +487,159 @@ func (store *Store) serviceInstances(service ecsTypes.Service) ([]ec2Types.Insta
 		return nil, nil
 	}
 
+	return store.describeTasks(service.ClusterArn, taskList.TaskArns)
+}
+
+// describeTasks returns details of the tasks with hosts they are placed on and their addresses
+func (store *Store) describeTasks(clusterArn *string, taskArns []string) ([]Task, error) {
 	// Describe the tasks to get the container instances
-	taskDetails, err := store.ecsClient.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
-		Cluster: service.ClusterArn,
-		Tasks:   taskList.TaskArns,
+	taskDetailsOutput, err := store.ecsClient.DescribeTasks(context.TODO(), &ecs.DescribeTasksInput{
+		Cluster: clusterArn,
+		Tasks:   taskArns,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to describe tasks for cluster %v: %w", *service.ClusterArn, err)
+		return nil, fmt.Errorf("failed to describe tasks for cluster %v: %w", *clusterArn, err)
 	}
+	return store.tasks(clusterArn, taskDetailsOutput.Tasks)
+}
 
-	var containerInstanceArns []string
-	for _, task := range taskDetails.Tasks {
-		if task.ContainerInstanceArn != nil {
+// tasks adds hosts and addresses to described tasks
+func (store *Store) tasks(clusterArn *string, tasks []ecsTypes.Task) ([]Task, error) {
+	var containerInstanceArns, eniIDs []string
+	for _, task := range tasks {
+		if task.ContainerInstanceArn != nil && !lo.Contains(containerInstanceArns, *task.ContainerInstanceArn) {
 			containerInstanceArns = append(containerInstanceArns, *task.ContainerInstanceArn)
 		}
+		if eniID, ok := attachmentDetail(task, "networkInterfaceId"); ok {
+			eniIDs = append(eniIDs, eniID)
+		}
 	}
 
+	hosts, err := store.hosts(clusterArn, containerInstanceArns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Describe network interfaces of awsvpc tasks to get their addresses
+	enis, err := store.networkInterfaces(eniIDs)
+	if err != nil {
+		return nil, err
+	}
+	interfaces := lo.MapToSlice(enis, func(_ string, eni ec2Types.NetworkInterface) networkInterface {
+		return taskNetworkInterface(eni)
+	})
+	net := store.network(interfaces)
+	interfaceAddresses := map[string][]Address{}
+	for _, eni := range interfaces {
+		interfaceAddresses[eni.id] = addresses([]networkInterface{eni}, net)
+	}
+
+	return lo.Map(tasks, func(task ecsTypes.Task, _ int) Task {
+		return taskDetails(task, hosts, interfaceAddresses)
+	}), nil
+}
+
+// hosts returns EC2 and external instances by container instance ARN
+func (store *Store) hosts(clusterArn *string, containerInstanceArns []string) (map[string]Host, error) {
+	res := map[string]Host{}
 	if len(containerInstanceArns) == 0 {
 		log.Println("No container instances found")
-		return nil, nil
+		return res, nil
 	}
 
 	// Describe container instances to get the EC2 instance IDs
 	describeContainerInstancesOutput, err := store.ecsClient.DescribeContainerInstances(context.TODO(), &ecs.DescribeContainerInstancesInput{
-		Cluster:            service.ClusterArn,
+		Cluster:            clusterArn,
 		ContainerInstances: containerInstanceArns,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to describe container instances: %w", err)
 	}
 
-	var ec2InstanceIds []string
+	// for external instances of ECS Anywhere the instance ID is Systems Manager managed instance ID
+	var ec2InstanceIds, managedInstanceIds []string
+	containerInstances := map[string]string{}
 	for _, containerInstance := range describeContainerInstancesOutput.ContainerInstances {
-		if containerInstance.Ec2InstanceId != nil {
+		if containerInstance.Ec2InstanceId == nil {
+			continue
+		}
+		if strings.HasPrefix(*containerInstance.Ec2InstanceId, "mi-") {
+			managedInstanceIds = append(managedInstanceIds, *containerInstance.Ec2InstanceId)
+		} else {
 			ec2InstanceIds = append(ec2InstanceIds, *containerInstance.Ec2InstanceId)
 		}
+		containerInstances[*containerInstance.Ec2InstanceId] = *containerInstance.ContainerInstanceArn
 	}
 
-	if len(ec2InstanceIds) == 0 {
-		fmt.Println("No EC2 instances found")
-		return nil, nil
+	if len(ec2InstanceIds) > 0 {
+		// Describe EC2 instances to get their IP addresses
+		describeInstancesOutput, err := store.ec2Client.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{
+			InstanceIds: ec2InstanceIds,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instances: %w", err)
+		}
+
+		instances := []ec2Types.Instance{}
+		for _, reservation := range describeInstancesOutput.Reservations {
+			instances = append(instances, reservation.Instances...)
+		}
+		net := store.network(lo.FlatMap(instances, func(instance ec2Types.Instance, _ int) []networkInterface {
+			return instanceNetworkInterfaces(instance)
+		}))
+
+		for _, instance := range instances {
+			res[containerInstances[*instance.InstanceId]] = Host{
+				ID:        *instance.InstanceId,
+				Hostname:  lo.FromPtr(instance.PrivateDnsName),
+				Addresses: addresses(instanceNetworkInterfaces(instance), net),
+				Spot:      instance.InstanceLifecycle == ec2Types.InstanceLifecycleTypeSpot,
+			}
+		}
 	}
 
-	// Describe EC2 instances to get their IP addresses
-	describeInstancesOutput, err := store.ec2Client.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{
-		InstanceIds: ec2InstanceIds,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to describe instances: %w", err)
+	if len(managedInstanceIds) > 0 {
+		managedInstances, err := store.managedInstances(managedInstanceIds)
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range managedInstances {
+			host := Host{
+				ID:        *instance.InstanceId,
+				Hostname:  lo.FromPtr(instance.ComputerName),
+				Addresses: []Address{},
+				External:  true,
+			}
+			if address, ok := parseAddress(instance.IPAddress, AddressPrivate, Address{}); ok {
+				host.Addresses = append(host.Addresses, address)
+			}
+			res[containerInstances[*instance.InstanceId]] = host
+		}
 	}
 
-	// Get Instances
-	res := []ec2Types.Instance{}
-	for _, reservation := range describeInstancesOutput.Reservations {
-		res = append(res, reservation.Instances...)
+	if len(res) == 0 {
+		log.Println("No instances found")
+	}
+	return res, nil
+}
+
+// managedInstances describes ECS Anywhere external instances registered in Systems Manager
+func (store *Store) managedInstances(ids []string) ([]ssmTypes.InstanceInformation, error) {
+	res := []ssmTypes.InstanceInformation{}
+	paginator := ssm.NewDescribeInstanceInformationPaginator(store.ssmClient, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmTypes.InstanceInformationStringFilter{
+			{
+				Key:    lo.ToPtr("InstanceIds"),
+				Values: ids,
+			},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe managed instances: %w", err)
+		}
+		res = append(res, page.InstanceInformationList...)
 	}
 	return res, nil
 }
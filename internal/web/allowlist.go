@@ -0,0 +1,183 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/samber/lo"
+)
+
+// AllowlistEntry is an aggregated CIDR with services owning its addresses
+type AllowlistEntry struct {
+	CIDR     netip.Prefix
+	Services []string
+}
+
+// PrefixListEntry is an entry of AWS managed prefix list in the format of modify-managed-prefix-list --add-entries
+type PrefixListEntry struct {
+	Cidr        string `json:"Cidr"`
+	Description string `json:"Description,omitempty"`
+}
+
+func (server *FiberServer) registerAllowlist() {
+	server.Get("/export/allowlist", func(c *fiber.Ctx) error {
+		filter := filterFromQuery(c)
+		entries := allowlist(Filtered(server.clusters(), filter), filter.IPVersion)
+		name := c.Query("name", "ecs_ip")
+
+		switch c.Query("format", "text") {
+		case "text":
+			return c.SendString(joinLines(entries, func(entry AllowlistEntry) string {
+				return entry.CIDR.String()
+			}))
+		case "json":
+			return c.JSON(map[string][]string{
+				"ipv4": cidrStrings(entries, true),
+				"ipv6": cidrStrings(entries, false),
+			})
+		case "iptables":
+			return c.SendString(joinLines(entries, func(entry AllowlistEntry) string {
+				command := "iptables"
+				if entry.CIDR.Addr().Is6() {
+					command = "ip6tables"
+				}
+				return fmt.Sprintf("%s -A %s -s %s -j ACCEPT", command, name, entry.CIDR)
+			}))
+		case "nftables":
+			return c.SendString(nftablesSet(name+"_v4", "ipv4_addr", cidrStrings(entries, true)) +
+				nftablesSet(name+"_v6", "ipv6_addr", cidrStrings(entries, false)))
+		case "nginx":
+			return c.SendString(joinLines(entries, func(entry AllowlistEntry) string {
+				return fmt.Sprintf("allow %s;", entry.CIDR)
+			}))
+		case "aws":
+			return c.JSON(lo.Map(entries, func(entry AllowlistEntry, _ int) PrefixListEntry {
+				return PrefixListEntry{
+					Cidr:        entry.CIDR.String(),
+					Description: prefixListDescription(entry.Services),
+				}
+			}))
+		default:
+			return fiber.NewError(fiber.StatusBadRequest, "format must be one of text, json, iptables, nftables, nginx, aws")
+		}
+	})
+}
+
+// allowlist collects public addresses of the services, auto-assigned, elastic and global IPv6 ones,
+// and collapses them into minimal CIDRs
+func allowlist(clusters []aws.Cluster, ipVersion string) []AllowlistEntry {
+	owners := map[netip.Addr][]string{}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			for _, address := range service.Addresses {
+				public := address.Public() || (address.Kind == aws.AddressIPv6 && address.IP.IsGlobalUnicast() && !address.IP.IsPrivate())
+				if !public || (ipVersion == "4" && !address.IP.Is4()) || (ipVersion == "6" && !address.IP.Is6()) {
+					continue
+				}
+				owners[address.IP] = appendUnique(owners[address.IP], service.Name)
+			}
+		}
+	}
+
+	prefixes := lo.MapToSlice(owners, func(ip netip.Addr, _ []string) netip.Prefix {
+		return netip.PrefixFrom(ip, ip.BitLen())
+	})
+	res := []AllowlistEntry{}
+	for _, prefix := range aggregate(prefixes) {
+		entry := AllowlistEntry{CIDR: prefix, Services: []string{}}
+		for ip, services := range owners {
+			if prefix.Contains(ip) {
+				for _, service := range services {
+					entry.Services = appendUnique(entry.Services, service)
+				}
+			}
+		}
+		sort.Strings(entry.Services)
+		res = append(res, entry)
+	}
+	return res
+}
+
+// aggregate returns the minimal list of prefixes covering exactly the same addresses,
+// IPv4-mapped IPv6 prefixes are treated as IPv4 ones
+func aggregate(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := lo.Map(prefixes, func(prefix netip.Prefix, _ int) netip.Prefix {
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked()
+	})
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Addr() != sorted[j].Addr() {
+			return sorted[i].Addr().Less(sorted[j].Addr())
+		}
+		return sorted[i].Bits() < sorted[j].Bits()
+	})
+
+	res := []netip.Prefix{}
+	for _, prefix := range sorted {
+		// skip prefixes inside the previous one, sorting puts the wider prefix first
+		if len(res) > 0 && res[len(res)-1].Overlaps(prefix) {
+			continue
+		}
+		res = append(res, prefix)
+		// merge the last two prefixes while they are two halves of the same parent
+		for len(res) > 1 {
+			left, right := res[len(res)-2], res[len(res)-1]
+			if left.Bits() != right.Bits() || left.Bits() == 0 {
+				break
+			}
+			parent := netip.PrefixFrom(left.Addr(), left.Bits()-1).Masked()
+			if parent.Addr() != left.Addr() || !parent.Contains(right.Addr()) {
+				break
+			}
+			res = append(res[:len(res)-2], parent)
+		}
+	}
+	return res
+}
+
+func cidrStrings(entries []AllowlistEntry, ipv4 bool) []string {
+	res := []string{}
+	for _, entry := range entries {
+		if entry.CIDR.Addr().Is4() == ipv4 {
+			res = append(res, entry.CIDR.String())
+		}
+	}
+	return res
+}
+
+func joinLines(entries []AllowlistEntry, line func(AllowlistEntry) string) string {
+	var res strings.Builder
+	for _, entry := range entries {
+		res.WriteString(line(entry))
+		res.WriteString("\n")
+	}
+	return res.String()
+}
+
+// nftablesSet renders a named set, nft does not accept empty elements so the line is omitted for an empty set
+func nftablesSet(name string, addressType string, cidrs []string) string {
+	var res strings.Builder
+	fmt.Fprintf(&res, "set %s {\n", name)
+	fmt.Fprintf(&res, "\ttype %s\n", addressType)
+	res.WriteString("\tflags interval\n")
+	if len(cidrs) > 0 {
+		fmt.Fprintf(&res, "\telements = { %s }\n", strings.Join(cidrs, ", "))
+	}
+	res.WriteString("}\n")
+	return res.String()
+}
+
+// prefixListDescription lists owning services, AWS limits the description to 255 characters
+func prefixListDescription(services []string) string {
+	res := strings.Join(services, ", ")
+	if len(res) > 255 {
+		res = res[:252] + "..."
+	}
+	return res
+}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []string
+		want     []string
+	}{
+		{"adjacent addresses", []string{"10.0.0.0/32", "10.0.0.1/32", "10.0.0.2/32", "10.0.0.3/32"}, []string{"10.0.0.0/30"}},
+		{"unsorted addresses", []string{"10.0.0.3/32", "10.0.0.1/32", "10.0.0.2/32", "10.0.0.0/32"}, []string{"10.0.0.0/30"}},
+		{"uneven run", []string{"10.0.0.0/32", "10.0.0.1/32", "10.0.0.2/32", "10.0.0.3/32", "10.0.0.4/32", "10.0.0.5/32"}, []string{"10.0.0.0/30", "10.0.0.4/31"}},
+		{"run across a boundary", []string{"10.0.0.1/32", "10.0.0.2/32"}, []string{"10.0.0.1/32", "10.0.0.2/32"}},
+		{"duplicates", []string{"10.0.0.1/32", "10.0.0.1/32", "10.0.0.0/32"}, []string{"10.0.0.0/31"}},
+		{"address inside a prefix", []string{"10.0.0.0/24", "10.0.0.7/32"}, []string{"10.0.0.0/24"}},
+		{"mixed families", []string{"2001:db8::1/128", "10.0.0.1/32", "2001:db8::/128", "10.0.0.0/32"}, []string{"10.0.0.0/31", "2001:db8::/127"}},
+		{"ipv4-mapped addresses", []string{"::ffff:10.0.0.0/128", "10.0.0.1/32"}, []string{"10.0.0.0/31"}},
+		{"empty", []string{}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prefixes := []netip.Prefix{}
+			for _, prefix := range test.prefixes {
+				prefixes = append(prefixes, netip.MustParsePrefix(prefix))
+			}
+			got := []string{}
+			for _, prefix := range aggregate(prefixes) {
+				got = append(got, prefix.String())
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("aggregate(%v) = %v, want %v", test.prefixes, got, test.want)
+			}
+		})
+	}
+}
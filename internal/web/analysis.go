@@ -0,0 +1,136 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// Analysis lists address collisions and overlapping CIDRs of connected VPCs in the crawled inventory
+type Analysis struct {
+	Collisions []Collision
+	Overlaps   []Overlap
+}
+
+// Collision is a private address used in several networks, i.e. in different accounts, regions or VPCs
+type Collision struct {
+	IP     netip.Addr
+	Owners []Owner
+}
+
+// Overlap is a pair of connected VPCs with overlapping CIDRs
+type Overlap struct {
+	Left       VpcRef
+	Right      VpcRef
+	LeftCIDR   netip.Prefix
+	RightCIDR  netip.Prefix
+	Connection string
+}
+
+type VpcRef struct {
+	ID      string
+	Name    string
+	Account string
+	Region  string
+}
+
+func (vpc VpcRef) Label() string {
+	return fmt.Sprintf("%s (%s, %s)", label(vpc.ID, vpc.Name), vpc.Account, vpc.Region)
+}
+
+func analyze(clusters []aws.Cluster) Analysis {
+	return Analysis{
+		Collisions: collisions(newAddressIndex(clusters)),
+		Overlaps:   overlaps(clusters),
+	}
+}
+
+func collisions(index *AddressIndex) []Collision {
+	res := []Collision{}
+	// owners are sorted by address, so owners of the same address go one after another
+	for start := 0; start < len(index.owners); {
+		end := start
+		networks := []string{}
+		for end < len(index.owners) && index.owners[end].Address.IP == index.owners[start].Address.IP {
+			owner := index.owners[end]
+			network := fmt.Sprintf("%s/%s/%s", owner.Account, owner.Region, owner.Address.VpcID)
+			if !slices.Contains(networks, network) {
+				networks = append(networks, network)
+			}
+			end++
+		}
+		if index.owners[start].Address.Kind == aws.AddressPrivate && len(networks) > 1 {
+			res = append(res, Collision{
+				IP:     index.owners[start].Address.IP,
+				Owners: index.owners[start:end],
+			})
+		}
+		start = end
+	}
+	return res
+}
+
+func overlaps(clusters []aws.Cluster) []Overlap {
+	vpcs := []aws.Vpc{}
+	for _, cluster := range clusters {
+		for _, vpc := range cluster.Vpcs {
+			if !slices.ContainsFunc(vpcs, func(v aws.Vpc) bool { return sameVpc(v, vpc) }) {
+				vpcs = append(vpcs, vpc)
+			}
+		}
+	}
+
+	res := []Overlap{}
+	seenPeerings := []string{}
+	for _, vpc := range vpcs {
+		for _, peering := range vpc.Peerings {
+			// a peering is seen from both sides when both VPCs are crawled
+			if slices.Contains(seenPeerings, peering.ID) {
+				continue
+			}
+			seenPeerings = append(seenPeerings, peering.ID)
+			remote := VpcRef{ID: peering.VpcID, Account: peering.Account, Region: peering.Region}
+			if index := slices.IndexFunc(vpcs, func(v aws.Vpc) bool { return v.ID == peering.VpcID && v.Account == peering.Account }); index != -1 {
+				remote.Name = vpcs[index].Name
+			}
+			res = appendOverlaps(res, vpcRef(vpc), remote, vpc.CIDRs, peering.CIDRs, fmt.Sprintf("peering %s", peering.ID))
+		}
+	}
+
+	for i, left := range vpcs {
+		for _, right := range vpcs[i+1:] {
+			for _, transitGateway := range left.TransitGateways {
+				if slices.Contains(right.TransitGateways, transitGateway) {
+					res = appendOverlaps(res, vpcRef(left), vpcRef(right), left.CIDRs, right.CIDRs, fmt.Sprintf("transit gateway %s", transitGateway))
+				}
+			}
+		}
+	}
+	return res
+}
+
+func appendOverlaps(res []Overlap, left VpcRef, right VpcRef, leftCIDRs []netip.Prefix, rightCIDRs []netip.Prefix, connection string) []Overlap {
+	for _, leftCIDR := range leftCIDRs {
+		for _, rightCIDR := range rightCIDRs {
+			if leftCIDR.Overlaps(rightCIDR) {
+				res = append(res, Overlap{
+					Left:       left,
+					Right:      right,
+					LeftCIDR:   leftCIDR,
+					RightCIDR:  rightCIDR,
+					Connection: connection,
+				})
+			}
+		}
+	}
+	return res
+}
+
+func sameVpc(left aws.Vpc, right aws.Vpc) bool {
+	return left.ID == right.ID && left.Account == right.Account && left.Region == right.Region
+}
+
+func vpcRef(vpc aws.Vpc) VpcRef {
+	return VpcRef{ID: vpc.ID, Name: vpc.Name, Account: vpc.Account, Region: vpc.Region}
+}
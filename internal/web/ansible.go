@@ -0,0 +1,144 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/samber/lo"
+)
+
+// AnsibleGroup is a group of Ansible dynamic inventory
+type AnsibleGroup struct {
+	Hosts    []string `json:"hosts,omitempty"`
+	Children []string `json:"children,omitempty"`
+}
+
+func (server *FiberServer) registerAnsible() {
+	server.Get("/export/ansible", func(c *fiber.Ctx) error {
+		return c.JSON(AnsibleInventory(Filtered(server.clusters(), filterFromQuery(c))))
+	})
+}
+
+// AnsibleInventory returns Ansible dynamic inventory of EC2 and external hosts: groups per cluster, service, app, env
+// and component, and host variables with addresses and metadata of services running on the host.
+// Fargate tasks have no hosts, so they are not in the inventory.
+func AnsibleInventory(clusters []aws.Cluster) map[string]any {
+	groups := map[string]*AnsibleGroup{}
+	hostVars := map[string]map[string]any{}
+
+	addHost := func(group string, host aws.Host) {
+		if groups[group] == nil {
+			groups[group] = &AnsibleGroup{}
+		}
+		if !lo.Contains(groups[group].Hosts, host.ID) {
+			groups[group].Hosts = append(groups[group].Hosts, host.ID)
+		}
+	}
+	addChild := func(group string, child string) {
+		if groups[group] == nil {
+			groups[group] = &AnsibleGroup{}
+		}
+		if !lo.Contains(groups[group].Children, child) {
+			groups[group].Children = append(groups[group].Children, child)
+		}
+	}
+	hostVar := func(cluster aws.Cluster, host aws.Host) map[string]any {
+		if vars, ok := hostVars[host.ID]; ok {
+			return vars
+		}
+		vars := map[string]any{
+			"instance_id": host.ID,
+			"hostname":    host.Hostname,
+			"external":    host.External,
+			"spot":        host.Spot,
+			"cluster":     cluster.Name,
+			"region":      cluster.Region,
+			"account":     cluster.Account,
+			"private_ips": aws.AddressStrings(host.Addresses, aws.AddressPrivate),
+			"public_ips":  aws.AddressStrings(host.Addresses, aws.AddressPublic, aws.AddressElastic),
+			"ipv6_ips":    aws.AddressStrings(host.Addresses, aws.AddressIPv6),
+			"services":    []string{},
+			"apps":        []string{},
+			"envs":        []string{},
+			"components":  []string{},
+			"versions":    []string{},
+		}
+		if ip, ok := ansibleHostIP(host); ok {
+			vars["ansible_host"] = ip
+		}
+		hostVars[host.ID] = vars
+		return vars
+	}
+	appendVar := func(vars map[string]any, key string, value string) {
+		if value != "" && !lo.Contains(vars[key].([]string), value) {
+			vars[key] = append(vars[key].([]string), value)
+		}
+	}
+
+	for _, cluster := range clusters {
+		clusterGroup := ansibleGroupName("cluster", cluster.Name)
+		addChild("all", clusterGroup)
+		for _, host := range cluster.Hosts {
+			hostVar(cluster, host)
+			addHost(clusterGroup, host)
+		}
+		for _, service := range cluster.Services {
+			for _, host := range service.Hosts() {
+				vars := hostVar(cluster, host)
+				addHost(clusterGroup, host)
+				appendVar(vars, "services", service.Name)
+				appendVar(vars, "apps", service.App)
+				appendVar(vars, "envs", service.Env)
+				appendVar(vars, "components", service.Component)
+				appendVar(vars, "versions", service.Version)
+
+				for prefix, value := range map[string]string{
+					"service":   service.Name,
+					"app":       service.App,
+					"env":       service.Env,
+					"component": service.Component,
+				} {
+					if value != "" {
+						addChild("all", ansibleGroupName(prefix, value))
+						addHost(ansibleGroupName(prefix, value), host)
+					}
+				}
+			}
+		}
+	}
+
+	res := map[string]any{
+		"_meta": map[string]any{"hostvars": hostVars},
+	}
+	for name, group := range groups {
+		sort.Strings(group.Hosts)
+		sort.Strings(group.Children)
+		res[name] = group
+	}
+	if _, ok := res["all"]; !ok {
+		res["all"] = AnsibleGroup{}
+	}
+	return res
+}
+
+var ansibleInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ansibleGroupName builds a valid Ansible group name, only letters, digits and underscores are allowed
+func ansibleGroupName(prefix string, value string) string {
+	return prefix + "_" + ansibleInvalidChars.ReplaceAllString(strings.ToLower(value), "_")
+}
+
+// ansibleHostIP returns the private IPv4 address of the host, or the public one when there is no private address
+func ansibleHostIP(host aws.Host) (string, bool) {
+	for _, kinds := range [][]aws.AddressKind{{aws.AddressPrivate}, {aws.AddressPublic, aws.AddressElastic}} {
+		for _, address := range host.Addresses {
+			if lo.Contains(kinds, address.Kind) && address.IP.Is4() {
+				return address.IP.String(), true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,167 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	_ "embed"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/samber/lo"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// openAPI is the OpenAPI 3 document of the JSON API, keep it in sync with the handlers below
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// Page is a paginated list of API items
+type Page[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// ClusterItem is a cluster without nested services, tasks and hosts
+type ClusterItem struct {
+	Arn      string `json:"arn"`
+	Name     string `json:"name"`
+	Region   string `json:"region"`
+	Account  string `json:"account"`
+	Services int    `json:"services"`
+	Tasks    int    `json:"tasks"`
+	Hosts    int    `json:"hosts"`
+}
+
+// ServiceItem is a service with the location of its cluster
+type ServiceItem struct {
+	Cluster string `json:"cluster"`
+	Region  string `json:"region"`
+	Account string `json:"account"`
+	aws.Service
+}
+
+// registerAPI adds versioned JSON endpoints of the inventory, they accept the same filters as the UI
+func (server *FiberServer) registerAPI() {
+	server.Get("/api/openapi.json", func(c *fiber.Ctx) error {
+		c.Type("json")
+		return c.Send(openAPI)
+	})
+
+	api := server.Group("/api/v1")
+
+	api.Get("/clusters", func(c *fiber.Ctx) error {
+		snapshot := server.cache.get()
+		return sendPage(c, snapshot, clusterItems(Filtered(snapshot.Clusters, filterFromQuery(c))))
+	})
+
+	api.Get("/services", func(c *fiber.Ctx) error {
+		snapshot := server.cache.get()
+		return sendPage(c, snapshot, serviceItems(Filtered(snapshot.Clusters, filterFromQuery(c))))
+	})
+
+	api.Get("/services/:cluster/:name", func(c *fiber.Ctx) error {
+		snapshot := server.cache.get()
+		for _, item := range serviceItems(snapshot.Clusters) {
+			if matchServiceParams(c, item.Cluster, item.Region, item.Account, item.Name) {
+				return sendJSON(c, snapshot, item)
+			}
+		}
+		return fiber.NewError(fiber.StatusNotFound, "service not found")
+	})
+
+	api.Get("/ips", func(c *fiber.Ctx) error {
+		snapshot := server.cache.get()
+		filter := filterFromQuery(c)
+		// filters pick owners, an owner may also have addresses of another family, network or outside the searched CIDR
+		owners := lo.Filter(newAddressIndex(Filtered(snapshot.Clusters, filter)).owners, func(owner Owner, _ int) bool {
+			return filter.MatchAddress(owner.Address)
+		})
+		return sendPage(c, snapshot, owners)
+	})
+}
+
+func clusterItems(clusters []aws.Cluster) []ClusterItem {
+	res := []ClusterItem{}
+	for _, cluster := range clusters {
+		res = append(res, clusterItem(cluster))
+	}
+	return res
+}
+
+func clusterItem(cluster aws.Cluster) ClusterItem {
+	res := ClusterItem{
+		Arn:      cluster.Arn,
+		Name:     cluster.Name,
+		Region:   cluster.Region,
+		Account:  cluster.Account,
+		Services: len(cluster.Services),
+		Hosts:    len(cluster.Hosts),
+	}
+	// tasks of services and standalone tasks, like the running tasks count of the ECS console
+	for _, service := range cluster.Services {
+		res.Tasks += len(service.Tasks)
+	}
+	for _, group := range cluster.TaskGroups {
+		res.Tasks += len(group.Tasks)
+	}
+	return res
+}
+
+func serviceItems(clusters []aws.Cluster) []ServiceItem {
+	res := []ServiceItem{}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			res = append(res, ServiceItem{
+				Cluster: cluster.Name,
+				Region:  cluster.Region,
+				Account: cluster.Account,
+				Service: service,
+			})
+		}
+	}
+	return res
+}
+
+// sendPage sends the requested page of items, limit and offset are taken from the query
+func sendPage[T any](c *fiber.Ctx, snapshot *Snapshot, items []T) error {
+	limit := c.QueryInt("limit", defaultPageLimit)
+	offset := c.QueryInt("offset", 0)
+	if limit < 1 || limit > maxPageLimit || offset < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d, offset must not be negative", maxPageLimit))
+	}
+	return sendJSON(c, snapshot, page(items, limit, offset))
+}
+
+func page[T any](items []T, limit int, offset int) Page[T] {
+	res := Page[T]{
+		Items:  []T{},
+		Total:  len(items),
+		Limit:  limit,
+		Offset: offset,
+	}
+	if offset < len(items) {
+		res.Items = items[offset:min(offset+limit, len(items))]
+	}
+	return res
+}
+
+// sendJSON sends the body with ETag derived from the snapshot and the request URL,
+// so the client gets 304 until the inventory changes
+func sendJSON(c *fiber.Ctx, snapshot *Snapshot, body any) error {
+	hash := fnv.New64a()
+	hash.Write([]byte(c.OriginalURL()))
+	etag := fmt.Sprintf(`"%s-%x"`, snapshot.ETag, hash.Sum64())
+
+	c.Set(fiber.HeaderETag, etag)
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	return c.JSON(body)
+}
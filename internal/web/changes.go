@@ -0,0 +1,156 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"slices"
+	"sort"
+
+	"github.com/samber/lo"
+)
+
+type ChangeKind string
+
+const (
+	ServiceAdded     ChangeKind = "service-added"
+	ServiceRemoved   ChangeKind = "service-removed"
+	ServiceChanged   ChangeKind = "service-changed"
+	TaskGroupAdded   ChangeKind = "task-group-added"
+	TaskGroupRemoved ChangeKind = "task-group-removed"
+	TaskGroupChanged ChangeKind = "task-group-changed"
+)
+
+// Change is a difference between two snapshots for one service or one group of standalone tasks
+type Change struct {
+	Kind ChangeKind
+	// ID is the id of the table row of the service or the task group
+	ID string
+	// Cluster is the cluster of the new snapshot, or of the old one when the item is removed
+	Cluster aws.Cluster
+	// Service is set for service changes, it is the removed service for ServiceRemoved
+	Service *aws.Service
+	// TaskGroup is set for task group changes, it is the removed group for TaskGroupRemoved
+	TaskGroup *aws.TaskGroup
+	// Fields are names of changed parts: addresses, tasks, version, deployment
+	Fields []string
+}
+
+// Removed reports whether the service or the task group disappeared
+func (change Change) Removed() bool {
+	return change.Kind == ServiceRemoved || change.Kind == TaskGroupRemoved
+}
+
+func serviceRowID(cluster aws.Cluster, service aws.Service) string {
+	return "service-" + cluster.Arn + "/" + service.Name
+}
+
+func taskGroupRowID(cluster aws.Cluster, group aws.TaskGroup) string {
+	return "task-group-" + cluster.Arn + "/" + group.Group + "/" + group.StartedBy
+}
+
+// diff compares services and standalone task groups of two snapshots
+func diff(previous []aws.Cluster, current []aws.Cluster) []Change {
+	type serviceRef struct {
+		cluster aws.Cluster
+		service aws.Service
+	}
+	type groupRef struct {
+		cluster aws.Cluster
+		group   aws.TaskGroup
+	}
+	index := func(clusters []aws.Cluster) (map[string]serviceRef, map[string]groupRef) {
+		services := map[string]serviceRef{}
+		groups := map[string]groupRef{}
+		for _, cluster := range clusters {
+			for _, service := range cluster.Services {
+				services[serviceRowID(cluster, service)] = serviceRef{cluster, service}
+			}
+			for _, group := range cluster.TaskGroups {
+				groups[taskGroupRowID(cluster, group)] = groupRef{cluster, group}
+			}
+		}
+		return services, groups
+	}
+	previousServices, previousGroups := index(previous)
+	currentServices, currentGroups := index(current)
+
+	res := []Change{}
+	for id, ref := range currentServices {
+		old, ok := previousServices[id]
+		switch {
+		case !ok:
+			res = append(res, Change{Kind: ServiceAdded, ID: id, Cluster: ref.cluster, Service: lo.ToPtr(ref.service)})
+		case len(serviceDifferences(old.service, ref.service)) > 0:
+			res = append(res, Change{
+				Kind:    ServiceChanged,
+				ID:      id,
+				Cluster: ref.cluster,
+				Service: lo.ToPtr(ref.service),
+				Fields:  serviceDifferences(old.service, ref.service),
+			})
+		}
+	}
+	for id, ref := range previousServices {
+		if _, ok := currentServices[id]; !ok {
+			res = append(res, Change{Kind: ServiceRemoved, ID: id, Cluster: ref.cluster, Service: lo.ToPtr(ref.service)})
+		}
+	}
+	for id, ref := range currentGroups {
+		old, ok := previousGroups[id]
+		switch {
+		case !ok:
+			res = append(res, Change{Kind: TaskGroupAdded, ID: id, Cluster: ref.cluster, TaskGroup: lo.ToPtr(ref.group)})
+		case len(taskDifferences(old.group.Tasks, ref.group.Tasks)) > 0:
+			res = append(res, Change{
+				Kind:      TaskGroupChanged,
+				ID:        id,
+				Cluster:   ref.cluster,
+				TaskGroup: lo.ToPtr(ref.group),
+				Fields:    taskDifferences(old.group.Tasks, ref.group.Tasks),
+			})
+		}
+	}
+	for id, ref := range previousGroups {
+		if _, ok := currentGroups[id]; !ok {
+			res = append(res, Change{Kind: TaskGroupRemoved, ID: id, Cluster: ref.cluster, TaskGroup: lo.ToPtr(ref.group)})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+func serviceDifferences(previous aws.Service, current aws.Service) []string {
+	res := taskDifferences(previous.Tasks, current.Tasks)
+	if !slices.Equal(addressIPs(previous.Addresses), addressIPs(current.Addresses)) && !slices.Contains(res, "addresses") {
+		res = append(res, "addresses")
+	}
+	if previous.Image != current.Image || previous.TaskDefinition.Arn != current.TaskDefinition.Arn {
+		res = append(res, "version")
+	}
+	if previous.RolloutState != current.RolloutState || previous.DesiredCount != current.DesiredCount ||
+		previous.RunningCount != current.RunningCount || previous.PendingCount != current.PendingCount {
+		res = append(res, "deployment")
+	}
+	return res
+}
+
+func taskDifferences(previous []aws.Task, current []aws.Task) []string {
+	res := []string{}
+	arns := func(tasks []aws.Task) []string {
+		res := lo.Map(tasks, func(task aws.Task, _ int) string { return task.Arn })
+		sort.Strings(res)
+		return res
+	}
+	if !slices.Equal(arns(previous), arns(current)) {
+		res = append(res, "tasks")
+	}
+	if !slices.Equal(addressIPs(taskAddresses(previous)), addressIPs(taskAddresses(current))) {
+		res = append(res, "addresses")
+	}
+	return res
+}
+
+func addressIPs(addresses []aws.Address) []string {
+	res := lo.Map(addresses, func(address aws.Address, _ int) string { return address.IP.String() })
+	sort.Strings(res)
+	return res
+}
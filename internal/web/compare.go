@@ -0,0 +1,170 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// Comparison is the result of comparing task definitions of two environments of the same application
+type Comparison struct {
+	App        string
+	Left       string
+	Right      string
+	Components []ComponentComparison
+}
+
+// ComponentComparison holds differences between task definitions of one component,
+// service is nil when the component is not deployed to the environment
+type ComponentComparison struct {
+	Component   string
+	Left        *aws.Service
+	Right       *aws.Service
+	Differences []Difference
+}
+
+type Difference struct {
+	Container string
+	Field     string
+	Left      string
+	Right     string
+}
+
+func compare(clusters []aws.Cluster, app string, left string, right string) Comparison {
+	res := Comparison{
+		App:        app,
+		Left:       left,
+		Right:      right,
+		Components: []ComponentComparison{},
+	}
+
+	components := map[string]*ComponentComparison{}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			if service.App != app || (service.Env != left && service.Env != right) {
+				continue
+			}
+			comparison, ok := components[service.Component]
+			if !ok {
+				comparison = &ComponentComparison{Component: service.Component}
+				components[service.Component] = comparison
+			}
+			// the first found service wins if the component is deployed to several clusters
+			if service.Env == left && comparison.Left == nil {
+				comparison.Left = &service
+			}
+			if service.Env == right && comparison.Right == nil {
+				comparison.Right = &service
+			}
+		}
+	}
+
+	names := lo.Keys(components)
+	sort.Strings(names)
+	for _, name := range names {
+		comparison := components[name]
+		if comparison.Left != nil && comparison.Right != nil {
+			comparison.Differences = compareTaskDefinitions(comparison.Left.TaskDefinition, comparison.Right.TaskDefinition)
+		}
+		res.Components = append(res.Components, *comparison)
+	}
+	return res
+}
+
+func compareTaskDefinitions(left aws.TaskDefinition, right aws.TaskDefinition) []Difference {
+	res := []Difference{}
+	res = appendDifference(res, "", "CPU", left.Cpu, right.Cpu)
+	res = appendDifference(res, "", "Memory", left.Memory, right.Memory)
+
+	leftContainers := containersByName(left)
+	rightContainers := containersByName(right)
+	onlyLeft, onlyRight := setDifference(lo.Keys(leftContainers), lo.Keys(rightContainers))
+	res = appendDifference(res, "", "Containers", onlyLeft, onlyRight)
+
+	names := lo.Keys(leftContainers)
+	sort.Strings(names)
+	for _, name := range names {
+		r, ok := rightContainers[name]
+		if !ok {
+			continue
+		}
+		l := leftContainers[name]
+		res = appendDifference(res, name, "Image", l.Image, r.Image)
+		res = appendDifference(res, name, "Version", l.Version, r.Version)
+		res = appendDifference(res, name, "CPU", fmt.Sprint(l.Cpu), fmt.Sprint(r.Cpu))
+		res = appendDifference(res, name, "Memory", fmt.Sprint(l.Memory), fmt.Sprint(r.Memory))
+
+		onlyLeft, onlyRight = setDifference(l.Environment, r.Environment)
+		res = appendDifference(res, name, "Environment", onlyLeft, onlyRight)
+
+		onlyLeft, onlyRight = setDifference(keyValues(l.Secrets), keyValues(r.Secrets))
+		res = appendDifference(res, name, "Secrets", onlyLeft, onlyRight)
+
+		onlyLeft, onlyRight = setDifference(portMappings(l.PortMappings), portMappings(r.PortMappings))
+		res = appendDifference(res, name, "Port mappings", onlyLeft, onlyRight)
+
+		res = appendDifference(res, name, "Log driver", l.LogDriver, r.LogDriver)
+		onlyLeft, onlyRight = setDifference(keyValues(l.LogOptions), keyValues(r.LogOptions))
+		res = appendDifference(res, name, "Log options", onlyLeft, onlyRight)
+	}
+	return res
+}
+
+func appendDifference(res []Difference, container string, field string, left string, right string) []Difference {
+	if left == right {
+		return res
+	}
+	return append(res, Difference{
+		Container: container,
+		Field:     field,
+		Left:      left,
+		Right:     right,
+	})
+}
+
+func containersByName(taskDefinition aws.TaskDefinition) map[string]aws.ContainerDefinition {
+	res := map[string]aws.ContainerDefinition{}
+	for _, container := range taskDefinition.Containers {
+		res[container.Name] = container
+	}
+	return res
+}
+
+// setDifference returns comma separated values which are present only in the left or only in the right list
+func setDifference(left []string, right []string) (string, string) {
+	onlyLeft := []string{}
+	for _, value := range left {
+		if !slices.Contains(right, value) {
+			onlyLeft = append(onlyLeft, value)
+		}
+	}
+	onlyRight := []string{}
+	for _, value := range right {
+		if !slices.Contains(left, value) {
+			onlyRight = append(onlyRight, value)
+		}
+	}
+	sort.Strings(onlyLeft)
+	sort.Strings(onlyRight)
+	return strings.Join(onlyLeft, ", "), strings.Join(onlyRight, ", ")
+}
+
+func keyValues(values map[string]string) []string {
+	res := []string{}
+	for key, value := range values {
+		res = append(res, fmt.Sprintf("%s=%s", key, value))
+	}
+	return res
+}
+
+func portMappings(mappings []aws.PortMapping) []string {
+	res := []string{}
+	for _, mapping := range mappings {
+		res = append(res, fmt.Sprintf("%d:%d/%s", mapping.HostPort, mapping.ContainerPort, mapping.Protocol))
+	}
+	return res
+}
@@ -0,0 +1,325 @@
+package web
+
+import (
+	"bytes"
+	"ecs-ip/internal/aws"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// ConsulConfig configures the sync of tasks to the Consul catalog
+type ConsulConfig struct {
+	// Address is the HTTP address of a Consul agent, e.g. http://127.0.0.1:8500
+	Address    string
+	Token      string
+	Datacenter string
+	// ServiceTemplate is the Consul service name, it is executed with NameData of the ECS service
+	ServiceTemplate string
+}
+
+const (
+	DefaultConsulAddress         = "http://127.0.0.1:8500"
+	DefaultConsulServiceTemplate = "{{.Name}}"
+	// consulManagedBy marks nodes registered by ecs-ip, only they are updated and deregistered
+	consulManagedBy = "ecs-ip"
+)
+
+// ConsulSync registers every task endpoint as a Consul service instance on a node of the task and deregisters
+// instances of tasks which are gone. Nodes carry managed-by=ecs-ip meta, so a sync after restart picks up
+// the previous registrations and changes only what differs.
+type ConsulSync struct {
+	config  ConsulConfig
+	client  *http.Client
+	service *template.Template
+}
+
+// ConsulSyncResult counts catalog writes of one sync
+type ConsulSyncResult struct {
+	Registered   int
+	Deregistered int
+	Unchanged    int
+}
+
+type consulService struct {
+	ID      string            `json:"ID"`
+	Service string            `json:"Service"`
+	Tags    []string          `json:"Tags"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Meta    map[string]string `json:"Meta"`
+}
+
+// consulRegistration is the body of /v1/catalog/register and /v1/catalog/deregister
+type consulRegistration struct {
+	Datacenter string            `json:"Datacenter,omitempty"`
+	Node       string            `json:"Node"`
+	Address    string            `json:"Address,omitempty"`
+	NodeMeta   map[string]string `json:"NodeMeta,omitempty"`
+	Service    *consulService    `json:"Service,omitempty"`
+	ServiceID  string            `json:"ServiceID,omitempty"`
+}
+
+// consulCatalogService is an item of /v1/catalog/service/:name
+type consulCatalogService struct {
+	Node           string            `json:"Node"`
+	Address        string            `json:"Address"`
+	ServiceID      string            `json:"ServiceID"`
+	ServiceName    string            `json:"ServiceName"`
+	ServiceTags    []string          `json:"ServiceTags"`
+	ServiceAddress string            `json:"ServiceAddress"`
+	ServicePort    int               `json:"ServicePort"`
+	ServiceMeta    map[string]string `json:"ServiceMeta"`
+}
+
+// NewConsulSync checks the config, client may be replaced to talk to a stand-in of the Consul HTTP API
+func NewConsulSync(config ConsulConfig, client *http.Client) (*ConsulSync, error) {
+	if config.Address == "" {
+		config.Address = DefaultConsulAddress
+	}
+	// CONSUL_HTTP_ADDR of the Consul CLI may come without scheme
+	if !strings.Contains(config.Address, "://") {
+		config.Address = "http://" + config.Address
+	}
+	config.Address = strings.TrimSuffix(config.Address, "/")
+	if config.ServiceTemplate == "" {
+		config.ServiceTemplate = DefaultConsulServiceTemplate
+	}
+	service, err := nameTemplate(config.ServiceTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &ConsulSync{config: config, client: client, service: service}, nil
+}
+
+// Sync makes ecs-ip registrations in the catalog match the tasks of the clusters, nothing is written without clusters
+func (sync *ConsulSync) Sync(clusters []aws.Cluster) (ConsulSyncResult, error) {
+	res := ConsulSyncResult{}
+	// a crawl which found nothing is more likely broken credentials than no tasks at all,
+	// deregistering everything would take all services out of the catalog
+	if len(clusters) == 0 {
+		return res, fmt.Errorf("no clusters crawled, registrations are kept")
+	}
+	desired, err := sync.registrations(clusters)
+	if err != nil {
+		return res, err
+	}
+	current, nodes, err := sync.current()
+	if err != nil {
+		return res, err
+	}
+
+	for id, registration := range desired {
+		if existing, ok := current[id]; ok && consulUnchanged(existing, registration) {
+			res.Unchanged++
+			continue
+		}
+		if err := sync.put("/v1/catalog/register", registration); err != nil {
+			return res, err
+		}
+		res.Registered++
+	}
+
+	desiredNodes := map[string]bool{}
+	for _, registration := range desired {
+		desiredNodes[registration.Node] = true
+	}
+	for id, existing := range current {
+		if _, ok := desired[id]; ok || !desiredNodes[existing.Node] {
+			continue
+		}
+		// the task is still there, but the endpoint is not, e.g. the service was renamed
+		err := sync.put("/v1/catalog/deregister", consulRegistration{Datacenter: sync.config.Datacenter, Node: existing.Node, ServiceID: id})
+		if err != nil {
+			return res, err
+		}
+		res.Deregistered++
+	}
+	// deregistering the node of a stopped task removes all its service instances
+	for _, node := range nodes {
+		if desiredNodes[node] {
+			continue
+		}
+		if err := sync.put("/v1/catalog/deregister", consulRegistration{Datacenter: sync.config.Datacenter, Node: node}); err != nil {
+			return res, err
+		}
+		res.Deregistered++
+	}
+	return res, nil
+}
+
+// registrations returns a registration per task endpoint keyed by service ID, the node of a task is named by its ID
+// and has the address of the task, tasks without private IPv4 address are skipped
+func (sync *ConsulSync) registrations(clusters []aws.Cluster) (map[string]consulRegistration, error) {
+	res := map[string]consulRegistration{}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			name, err := executeName(sync.service, nameData(cluster, service, 0, aws.Host{}, aws.Task{}))
+			if err != nil {
+				return nil, err
+			}
+			tags := []string{}
+			for _, tag := range []string{service.App, service.Env, service.Version} {
+				if tag != "" && !slices.Contains(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+
+			for _, task := range service.Tasks {
+				address, ok := taskTargetAddress(task)
+				if !ok {
+					continue
+				}
+				taskID := task.Arn[strings.LastIndex(task.Arn, "/")+1:]
+				node := "ecs-" + taskID
+				meta := map[string]string{
+					"app":       service.App,
+					"env":       service.Env,
+					"component": service.Component,
+					"version":   service.Version,
+					"cluster":   cluster.Name,
+					"region":    cluster.Region,
+					"account":   cluster.Account,
+					"service":   service.Name,
+					"task":      taskID,
+				}
+				endpoint := func(id string, container string, port int32) {
+					serviceMeta := maps.Clone(meta)
+					serviceMeta["container"] = container
+					// empty values are left out, so they do not differ from what Consul returns
+					maps.DeleteFunc(serviceMeta, func(_ string, value string) bool { return value == "" })
+					res[id] = consulRegistration{
+						Datacenter: sync.config.Datacenter,
+						Node:       node,
+						Address:    address.IP.String(),
+						// Consul ESM health checks nodes with external-node meta, probes are off as tasks may not answer ping
+						NodeMeta: map[string]string{"managed-by": consulManagedBy, "external-node": "true", "external-probe": "false"},
+						Service: &consulService{
+							ID:      id,
+							Service: name,
+							Tags:    tags,
+							Address: address.IP.String(),
+							Port:    int(port),
+							Meta:    serviceMeta,
+						},
+					}
+				}
+
+				ports := 0
+				for _, container := range service.TaskDefinition.Containers {
+					for _, mapping := range container.PortMappings {
+						ports++
+						endpoint(fmt.Sprintf("%s-%s-%d", name, taskID, mapping.ContainerPort), container.Name,
+							task.HostPort(container.Name, mapping.ContainerPort))
+					}
+				}
+				// tasks without ports are still found by address
+				if ports == 0 {
+					endpoint(fmt.Sprintf("%s-%s", name, taskID), "", 0)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// current returns service instances and nodes registered by ecs-ip
+func (sync *ConsulSync) current() (map[string]consulCatalogService, []string, error) {
+	query := url.Values{"node-meta": {"managed-by:" + consulManagedBy}}
+	var nodes []struct {
+		Node string `json:"Node"`
+	}
+	if err := sync.get("/v1/catalog/nodes", query, &nodes); err != nil {
+		return nil, nil, err
+	}
+	var services map[string][]string
+	if err := sync.get("/v1/catalog/services", query, &services); err != nil {
+		return nil, nil, err
+	}
+
+	res := map[string]consulCatalogService{}
+	for name := range services {
+		var instances []consulCatalogService
+		if err := sync.get("/v1/catalog/service/"+url.PathEscape(name), query, &instances); err != nil {
+			return nil, nil, err
+		}
+		for _, instance := range instances {
+			res[instance.ServiceID] = instance
+		}
+	}
+	names := []string{}
+	for _, node := range nodes {
+		names = append(names, node.Node)
+	}
+	return res, names, nil
+}
+
+// consulUnchanged compares the fields ecs-ip sets, Consul returns null for empty tags and meta which equal empty ones
+func consulUnchanged(existing consulCatalogService, registration consulRegistration) bool {
+	service := registration.Service
+	return existing.Node == registration.Node &&
+		existing.Address == registration.Address &&
+		existing.ServiceName == service.Service &&
+		existing.ServiceAddress == service.Address &&
+		existing.ServicePort == service.Port &&
+		slices.Equal(existing.ServiceTags, service.Tags) &&
+		maps.Equal(existing.ServiceMeta, service.Meta)
+}
+
+func (sync *ConsulSync) get(path string, query url.Values, value any) error {
+	if sync.config.Datacenter != "" {
+		query.Set("dc", sync.config.Datacenter)
+	}
+	req, err := http.NewRequest(http.MethodGet, sync.config.Address+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := sync.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(value)
+}
+
+func (sync *ConsulSync) put(path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, sync.config.Address+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := sync.do(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (sync *ConsulSync) do(req *http.Request) (*http.Response, error) {
+	if sync.config.Token != "" {
+		req.Header.Set("X-Consul-Token", sync.config.Token)
+	}
+	res, err := sync.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("consul %s %s: %d %s", req.Method, req.URL.Path, res.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return res, nil
+}
@@ -0,0 +1,225 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCatalog is a stand-in of the Consul catalog HTTP API with the endpoints ConsulSync uses
+type fakeCatalog struct {
+	mu       sync.Mutex
+	nodes    map[string]map[string]string
+	services map[string]consulCatalogService
+	writes   int
+}
+
+func newFakeCatalog(t *testing.T) (*fakeCatalog, *httptest.Server) {
+	catalog := &fakeCatalog{nodes: map[string]map[string]string{}, services: map[string]consulCatalogService{}}
+	server := httptest.NewServer(http.HandlerFunc(catalog.serve))
+	t.Cleanup(server.Close)
+	return catalog, server
+}
+
+func (catalog *fakeCatalog) serve(w http.ResponseWriter, r *http.Request) {
+	catalog.mu.Lock()
+	defer catalog.mu.Unlock()
+	// only the managed-by node meta filter is supported
+	managed := func(node string) bool {
+		filter := r.URL.Query().Get("node-meta")
+		return filter == "" || filter == "managed-by:"+catalog.nodes[node]["managed-by"]
+	}
+
+	var res any
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/catalog/nodes":
+		nodes := []map[string]string{}
+		for node := range catalog.nodes {
+			if managed(node) {
+				nodes = append(nodes, map[string]string{"Node": node})
+			}
+		}
+		res = nodes
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/catalog/services":
+		services := map[string][]string{}
+		for _, service := range catalog.services {
+			if managed(service.Node) {
+				services[service.ServiceName] = service.ServiceTags
+			}
+		}
+		res = services
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/catalog/service/"):
+		instances := []consulCatalogService{}
+		for _, service := range catalog.services {
+			if managed(service.Node) && service.ServiceName == strings.TrimPrefix(r.URL.Path, "/v1/catalog/service/") {
+				instances = append(instances, service)
+			}
+		}
+		res = instances
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/catalog/register":
+		var registration consulRegistration
+		if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		catalog.writes++
+		catalog.nodes[registration.Node] = registration.NodeMeta
+		if service := registration.Service; service != nil {
+			catalog.services[service.ID] = consulCatalogService{
+				Node:           registration.Node,
+				Address:        registration.Address,
+				ServiceID:      service.ID,
+				ServiceName:    service.Service,
+				ServiceTags:    service.Tags,
+				ServiceAddress: service.Address,
+				ServicePort:    service.Port,
+				ServiceMeta:    service.Meta,
+			}
+		}
+		res = true
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/catalog/deregister":
+		var registration consulRegistration
+		if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		catalog.writes++
+		for id, service := range catalog.services {
+			if service.Node == registration.Node && (registration.ServiceID == "" || registration.ServiceID == id) {
+				delete(catalog.services, id)
+			}
+		}
+		if registration.ServiceID == "" {
+			delete(catalog.nodes, registration.Node)
+		}
+		res = true
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func (catalog *fakeCatalog) serviceIDs() []string {
+	catalog.mu.Lock()
+	defer catalog.mu.Unlock()
+	res := []string{}
+	for id := range catalog.services {
+		res = append(res, id)
+	}
+	slices.Sort(res)
+	return res
+}
+
+func (catalog *fakeCatalog) nodeNames() []string {
+	catalog.mu.Lock()
+	defer catalog.mu.Unlock()
+	res := []string{}
+	for node := range catalog.nodes {
+		res = append(res, node)
+	}
+	slices.Sort(res)
+	return res
+}
+
+func consulTestTask(id string, ip string) aws.Task {
+	return aws.Task{
+		Arn:       "arn:aws:ecs:eu-west-1:123456789012:task/main/" + id,
+		Addresses: []aws.Address{{IP: netip.MustParseAddr(ip), Kind: aws.AddressPrivate}},
+	}
+}
+
+func consulTestClusters(port int32, tasks ...aws.Task) []aws.Cluster {
+	return []aws.Cluster{{
+		Name:    "main",
+		Region:  "eu-west-1",
+		Account: "123456789012",
+		Services: []aws.Service{{
+			Name: "web",
+			App:  "widgets",
+			Env:  "prod",
+			TaskDefinition: aws.TaskDefinition{Containers: []aws.ContainerDefinition{
+				{Name: "nginx", PortMappings: []aws.PortMapping{{ContainerPort: port}}},
+			}},
+			Tasks: tasks,
+		}},
+	}}
+}
+
+func TestConsulSync(t *testing.T) {
+	catalog, server := newFakeCatalog(t)
+	// a node registered by someone else must survive every sync
+	catalog.nodes["db"] = map[string]string{"managed-by": "terraform"}
+	catalog.services["db"] = consulCatalogService{Node: "db", ServiceID: "db", ServiceName: "db"}
+
+	sync, err := NewConsulSync(ConsulConfig{Address: server.URL}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(step string, clusters []aws.Cluster, want ConsulSyncResult, services []string, nodes []string) {
+		t.Helper()
+		res, err := sync.Sync(clusters)
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if res != want {
+			t.Errorf("%s: result %+v, want %+v", step, res, want)
+		}
+		if got := catalog.serviceIDs(); !slices.Equal(got, services) {
+			t.Errorf("%s: services %v, want %v", step, got, services)
+		}
+		if got := catalog.nodeNames(); !slices.Equal(got, nodes) {
+			t.Errorf("%s: nodes %v, want %v", step, got, nodes)
+		}
+	}
+
+	a := consulTestTask("aaaa", "10.0.0.1")
+	b := consulTestTask("bbbb", "10.0.0.2")
+	check("register", consulTestClusters(8080, a, b),
+		ConsulSyncResult{Registered: 2},
+		[]string{"db", "web-aaaa-8080", "web-bbbb-8080"},
+		[]string{"db", "ecs-aaaa", "ecs-bbbb"})
+
+	writes := catalog.writes
+	check("unchanged", consulTestClusters(8080, a, b),
+		ConsulSyncResult{Unchanged: 2},
+		[]string{"db", "web-aaaa-8080", "web-bbbb-8080"},
+		[]string{"db", "ecs-aaaa", "ecs-bbbb"})
+	if catalog.writes != writes {
+		t.Errorf("unchanged: %d writes, want none", catalog.writes-writes)
+	}
+
+	// the port of task a changed, so its old instance is stale, task b stopped, so its node is stale
+	check("deregister", consulTestClusters(9090, a),
+		ConsulSyncResult{Registered: 1, Deregistered: 2},
+		[]string{"db", "web-aaaa-9090"},
+		[]string{"db", "ecs-aaaa"})
+}
+
+func TestConsulSyncKeepsRegistrationsWithoutClusters(t *testing.T) {
+	catalog, server := newFakeCatalog(t)
+	sync, err := NewConsulSync(ConsulConfig{Address: server.URL}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sync.Sync(consulTestClusters(8080, consulTestTask("aaaa", "10.0.0.1"))); err != nil {
+		t.Fatal(err)
+	}
+	writes := catalog.writes
+
+	if _, err := sync.Sync(nil); err == nil {
+		t.Error("sync without clusters succeeded, want error")
+	}
+	if catalog.writes != writes {
+		t.Errorf("sync without clusters wrote %d times, want none", catalog.writes-writes)
+	}
+	if got := catalog.serviceIDs(); !slices.Equal(got, []string{"web-aaaa-8080"}) {
+		t.Errorf("services %v, want the previous registration", got)
+	}
+}
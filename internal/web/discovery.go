@@ -0,0 +1,107 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DiscoveryConfig selects metrics ports of containers for Prometheus service discovery
+type DiscoveryConfig struct {
+	// PortLabel is the Docker label with the metrics port of the container, several ports are separated by comma
+	PortLabel string
+	// PathLabel is the Docker label with the metrics path of the container
+	PathLabel string
+	// Ports are container ports which are metrics ports in any container exposing them
+	Ports []int32
+}
+
+// TargetGroup is an item of Prometheus http_sd_config response
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func (server *FiberServer) registerDiscovery() {
+	server.Get("/sd/prometheus", func(c *fiber.Ctx) error {
+		return c.JSON(targetGroups(Filtered(server.clusters(), filterFromQuery(c)), server.config.Discovery))
+	})
+}
+
+// targetGroups returns one target group per service, container metrics port and availability zone,
+// targets are private IPv4 addresses of the tasks with the port the container port is published on
+func targetGroups(clusters []aws.Cluster, config DiscoveryConfig) []TargetGroup {
+	res := []TargetGroup{}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			for _, container := range service.TaskDefinition.Containers {
+				for _, port := range metricsPorts(container, config) {
+					zones := map[string][]string{}
+					for _, task := range service.Tasks {
+						address, ok := taskTargetAddress(task)
+						if !ok {
+							continue
+						}
+						target := netip.AddrPortFrom(address.IP, uint16(task.HostPort(container.Name, port))).String()
+						zones[address.AvailabilityZone] = append(zones[address.AvailabilityZone], target)
+					}
+					for zone, targets := range zones {
+						sort.Strings(targets)
+						labels := map[string]string{
+							"cluster":           cluster.Name,
+							"region":            cluster.Region,
+							"account":           cluster.Account,
+							"service":           service.Name,
+							"app":               service.App,
+							"env":               service.Env,
+							"component":         service.Component,
+							"version":           service.Version,
+							"container":         container.Name,
+							"availability_zone": zone,
+						}
+						if path := container.DockerLabels[config.PathLabel]; config.PathLabel != "" && path != "" {
+							labels["__metrics_path__"] = path
+						}
+						res = append(res, TargetGroup{Targets: targets, Labels: labels})
+					}
+				}
+			}
+		}
+	}
+	// keep the response stable, so Prometheus does not see changes when nothing changed
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Targets[0] < res[j].Targets[0] })
+	return res
+}
+
+// metricsPorts returns container ports from the Docker label and the configured ports the container exposes
+func metricsPorts(container aws.ContainerDefinition, config DiscoveryConfig) []int32 {
+	res := []int32{}
+	if config.PortLabel != "" {
+		for _, value := range strings.Split(container.DockerLabels[config.PortLabel], ",") {
+			if port, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32); err == nil && !slices.Contains(res, int32(port)) {
+				res = append(res, int32(port))
+			}
+		}
+	}
+	for _, mapping := range container.PortMappings {
+		if slices.Contains(config.Ports, mapping.ContainerPort) && !slices.Contains(res, mapping.ContainerPort) {
+			res = append(res, mapping.ContainerPort)
+		}
+	}
+	return res
+}
+
+// taskTargetAddress returns the private IPv4 address of the task, Prometheus runs inside the VPC
+func taskTargetAddress(task aws.Task) (aws.Address, bool) {
+	for _, address := range task.Addresses {
+		if address.Kind == aws.AddressPrivate && address.IP.Is4() {
+			return address, true
+		}
+	}
+	return aws.Address{}, false
+}
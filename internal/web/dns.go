@@ -0,0 +1,257 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/miekg/dns"
+)
+
+// DNSConfig configures the embedded DNS server
+type DNSConfig struct {
+	// Zone is the domain the server is authoritative for, e.g. ecs.internal
+	Zone string
+	// NameTemplate is the name of a service within the zone, it is executed with NameData of the service
+	NameTemplate string
+}
+
+const (
+	DefaultDNSZone         = "ecs.internal"
+	DefaultDNSNameTemplate = "{{or .Component .Name}}.{{.Env}}.{{.App}}"
+)
+
+// dnsRecords are records of one name, services rendering the same name share it and are resolved round-robin
+type dnsRecords struct {
+	a    []netip.Addr
+	aaaa []netip.Addr
+	srv  []*dns.SRV
+}
+
+// dnsZone is the index of names built from one snapshot, it is rebuilt when the background refresh swaps the snapshot
+type dnsZone struct {
+	snapshot *Snapshot
+	names    map[string]*dnsRecords
+}
+
+// DNSHandler answers A, AAAA and SRV queries of services from the cached snapshot:
+//   - web.prod.widgets.ecs.internal has addresses of all tasks of the service and SRV records of all container ports
+//   - _8080._tcp.web.prod.widgets.ecs.internal and _nginx._tcp.web.prod.widgets.ecs.internal have SRV records of one
+//     container port or of one container
+//   - 0123456789abcdef.web.prod.widgets.ecs.internal is the task with the ID, it is the target of SRV records
+func (server *FiberServer) DNSHandler() (dns.Handler, error) {
+	zone := dns.Fqdn(strings.ToLower(server.config.DNS.Zone))
+	if zone == "." {
+		zone = dns.Fqdn(DefaultDNSZone)
+	}
+	text := server.config.DNS.NameTemplate
+	if text == "" {
+		text = DefaultDNSNameTemplate
+	}
+	name, err := nameTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	// records live as long as the snapshot, the next refresh may change them
+	ttl := uint32(max(server.config.CacheTTL.Seconds(), 1))
+
+	var mu sync.Mutex
+	current := &dnsZone{}
+	index := func() (*dnsZone, error) {
+		snapshot := server.cache.get()
+		mu.Lock()
+		defer mu.Unlock()
+		if current.snapshot != snapshot {
+			names, err := dnsNames(snapshot.Clusters, zone, name, ttl)
+			if err != nil {
+				return nil, err
+			}
+			current = &dnsZone{snapshot: snapshot, names: names}
+		}
+		return current, nil
+	}
+
+	return dns.HandlerFunc(func(w dns.ResponseWriter, request *dns.Msg) {
+		res := new(dns.Msg)
+		res.SetReply(request)
+		res.Authoritative = true
+		defer func() {
+			// UDP answers of services with many tasks are truncated, clients retry over TCP
+			if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+				size := dns.MinMsgSize
+				if opt := request.IsEdns0(); opt != nil {
+					size = int(opt.UDPSize())
+				}
+				res.Truncate(size)
+			}
+			w.WriteMsg(res)
+		}()
+
+		if len(request.Question) != 1 {
+			res.Rcode = dns.RcodeFormatError
+			return
+		}
+		question := request.Question[0]
+		qname := strings.ToLower(question.Name)
+		if !dns.IsSubDomain(zone, qname) {
+			res.Authoritative = false
+			res.Rcode = dns.RcodeRefused
+			return
+		}
+		current, err := index()
+		if err != nil {
+			res.Rcode = dns.RcodeServerFailure
+			return
+		}
+		soa := dnsSOA(zone, current.snapshot, ttl)
+		if qname == zone && (question.Qtype == dns.TypeSOA || question.Qtype == dns.TypeANY) {
+			res.Answer = append(res.Answer, soa)
+			return
+		}
+
+		records, ok := current.names[qname]
+		if !ok && qname != zone {
+			res.Rcode = dns.RcodeNameError
+			res.Ns = append(res.Ns, soa)
+			return
+		}
+		if ok {
+			header := dns.RR_Header{Name: question.Name, Class: dns.ClassINET, Ttl: ttl}
+			if question.Qtype == dns.TypeA || question.Qtype == dns.TypeANY {
+				for _, ip := range records.a {
+					header.Rrtype = dns.TypeA
+					res.Answer = append(res.Answer, &dns.A{Hdr: header, A: net.IP(ip.AsSlice())})
+				}
+			}
+			if question.Qtype == dns.TypeAAAA || question.Qtype == dns.TypeANY {
+				for _, ip := range records.aaaa {
+					header.Rrtype = dns.TypeAAAA
+					res.Answer = append(res.Answer, &dns.AAAA{Hdr: header, AAAA: net.IP(ip.AsSlice())})
+				}
+			}
+			if question.Qtype == dns.TypeSRV || question.Qtype == dns.TypeANY {
+				for _, srv := range records.srv {
+					record := *srv
+					record.Hdr.Name = question.Name
+					res.Answer = append(res.Answer, &record)
+					// addresses of targets save clients another query
+					for _, ip := range current.names[srv.Target].a {
+						res.Extra = append(res.Extra, &dns.A{
+							Hdr: dns.RR_Header{Name: srv.Target, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+							A:   net.IP(ip.AsSlice()),
+						})
+					}
+					for _, ip := range current.names[srv.Target].aaaa {
+						res.Extra = append(res.Extra, &dns.AAAA{
+							Hdr:  dns.RR_Header{Name: srv.Target, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl},
+							AAAA: net.IP(ip.AsSlice()),
+						})
+					}
+				}
+			}
+		}
+		if len(res.Answer) == 0 {
+			res.Ns = append(res.Ns, soa)
+		}
+	}), nil
+}
+
+// dnsNames renders names of services and their tasks within the zone
+func dnsNames(clusters []aws.Cluster, zone string, name *template.Template, ttl uint32) (map[string]*dnsRecords, error) {
+	res := map[string]*dnsRecords{}
+	records := func(name string) *dnsRecords {
+		if res[name] == nil {
+			res[name] = &dnsRecords{}
+		}
+		return res[name]
+	}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			serviceName, err := executeName(name, nameData(cluster, service, 0, aws.Host{}, aws.Task{}))
+			if err != nil {
+				return nil, err
+			}
+			serviceName = dnsName(serviceName, zone)
+			if serviceName == zone {
+				continue
+			}
+			records(serviceName)
+
+			for _, task := range service.Tasks {
+				taskName := dnsName(task.Arn[strings.LastIndex(task.Arn, "/")+1:]+"."+serviceName, "")
+				for _, address := range task.Addresses {
+					switch {
+					case address.Kind == aws.AddressPrivate && address.IP.Is4():
+						records(taskName).a = appendAddr(records(taskName).a, address.IP)
+						records(serviceName).a = appendAddr(records(serviceName).a, address.IP)
+					case address.Kind == aws.AddressIPv6:
+						records(taskName).aaaa = appendAddr(records(taskName).aaaa, address.IP)
+						records(serviceName).aaaa = appendAddr(records(serviceName).aaaa, address.IP)
+					}
+				}
+				// SRV targets must resolve, tasks without addresses yet are left out
+				if len(records(taskName).a) == 0 && len(records(taskName).aaaa) == 0 {
+					continue
+				}
+
+				for _, container := range service.TaskDefinition.Containers {
+					for _, mapping := range container.PortMappings {
+						protocol := strings.ToLower(mapping.Protocol)
+						if protocol == "" {
+							protocol = "tcp"
+						}
+						srv := &dns.SRV{
+							Hdr:      dns.RR_Header{Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: ttl},
+							Priority: 0,
+							Weight:   10,
+							Port:     uint16(task.HostPort(container.Name, mapping.ContainerPort)),
+							Target:   taskName,
+						}
+						for _, srvName := range []string{
+							serviceName,
+							"_" + strconv.Itoa(int(mapping.ContainerPort)) + "._" + protocol + "." + serviceName,
+							"_" + hostName(container.Name) + "._" + protocol + "." + serviceName,
+						} {
+							records(srvName).srv = append(records(srvName).srv, srv)
+						}
+					}
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// dnsName lowercases the name, drops empty labels left by empty template fields and appends the zone
+func dnsName(name string, zone string) string {
+	labels := slices.DeleteFunc(strings.Split(strings.ToLower(name), "."), func(label string) bool { return label == "" })
+	if zone != "" && zone != "." {
+		labels = append(labels, strings.TrimSuffix(zone, "."))
+	}
+	return dns.Fqdn(strings.Join(labels, "."))
+}
+
+func dnsSOA(zone string, snapshot *Snapshot, ttl uint32) *dns.SOA {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:      "ns." + zone,
+		Mbox:    "hostmaster." + zone,
+		Serial:  uint32(snapshot.FetchedAt.Unix()),
+		Refresh: ttl,
+		Retry:   ttl,
+		Expire:  ttl * 10,
+		Minttl:  ttl,
+	}
+}
+
+func appendAddr(addresses []netip.Addr, address netip.Addr) []netip.Addr {
+	if slices.Contains(addresses, address) {
+		return addresses
+	}
+	return append(addresses, address)
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// changeEvent is the data of a server-sent event, Row is the rendered table row when it is visible with the filter
+type changeEvent struct {
+	Kind    ChangeKind `json:"kind"`
+	ID      string     `json:"id"`
+	Table   string     `json:"table"`
+	Cluster string     `json:"cluster"`
+	Name    string     `json:"name"`
+	Fields  []string   `json:"fields,omitempty"`
+	Row     string     `json:"row,omitempty"`
+}
+
+// registerEvents adds the endpoint which streams inventory changes to the page,
+// it accepts the page filters so the page gets only rows it would show
+func (server *FiberServer) registerEvents() {
+	server.Get("/events", func(c *fiber.Ctx) error {
+		filter := filterFromQuery(c)
+		changes, unsubscribe := server.cache.subscribe()
+
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set(fiber.HeaderConnection, "keep-alive")
+		c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+			defer unsubscribe()
+			// comments keep proxies from closing the idle connection and detect gone clients
+			keepAlive := time.NewTicker(30 * time.Second)
+			defer keepAlive.Stop()
+
+			for {
+				select {
+				case batch := <-changes:
+					for _, change := range batch {
+						event, err := changeEventFor(change, filter)
+						if err != nil {
+							fmt.Fprintf(w, ": %s\n\n", err)
+							continue
+						}
+						data, _ := json.Marshal(event)
+						fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+					}
+				case <-keepAlive.C:
+					fmt.Fprint(w, ": keep-alive\n\n")
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}))
+		return nil
+	})
+}
+
+// changeEventFor renders the changed row as the page with the filter shows it,
+// the row is omitted when the item is removed or does not match the filter anymore
+func changeEventFor(change Change, filter Filter) (changeEvent, error) {
+	res := changeEvent{
+		Kind:    change.Kind,
+		ID:      change.ID,
+		Cluster: change.Cluster.Name,
+		Fields:  change.Fields,
+	}
+	var buf bytes.Buffer
+	if change.Service != nil {
+		res.Table = "services"
+		res.Name = change.Service.Name
+		if !change.Removed() && filter.MatchCluster(change.Cluster) && filter.Match(*change.Service) {
+			if err := ServiceRow(change.Cluster, *change.Service).Render(context.Background(), &buf); err != nil {
+				return res, err
+			}
+		}
+	}
+	if change.TaskGroup != nil {
+		res.Table = "task-groups"
+		res.Name = change.TaskGroup.Group
+		group := *change.TaskGroup
+		group.Tasks = nil
+		for _, task := range change.TaskGroup.Tasks {
+			if filter.MatchTask(task) {
+				group.Tasks = append(group.Tasks, task)
+			}
+		}
+		if !change.Removed() && filter.MatchCluster(change.Cluster) && len(group.Tasks) > 0 {
+			if err := TaskGroupRow(change.Cluster, group).Render(context.Background(), &buf); err != nil {
+				return res, err
+			}
+		}
+	}
+	res.Row = buf.String()
+	return res, nil
+}
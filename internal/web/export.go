@@ -0,0 +1,214 @@
+package web
+
+import (
+	"bytes"
+	"ecs-ip/internal/aws"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ExportConfig holds defaults of the SSH config and /etc/hosts exports, requests may override them in the query
+type ExportConfig struct {
+	// SSHNameTemplate is the name of Host entries, it is executed with NameData of every host of a service
+	SSHNameTemplate string
+	// HostsNameTemplate is the name of /etc/hosts entries, it is executed with NameData of every task of a service
+	HostsNameTemplate string
+	SSHUser           string
+	// SSHBastion is set as ProxyJump of every Host entry
+	SSHBastion string
+	// TemplatesDir holds user-defined text/template files served at /export/t/{name}
+	TemplatesDir string
+}
+
+// DefaultNameTemplate gives names like web-prod-1
+const DefaultNameTemplate = "{{or .Component .Name}}-{{.Env}}-{{.Index}}"
+
+// NameData is the data of name templates, service fields are available directly, e.g. {{.App}}-{{.Env}}-{{.Index}}
+type NameData struct {
+	aws.Service
+	Cluster string
+	Region  string
+	Account string
+	// Index is the number of the host or the task within the service starting from 1
+	Index int
+	// Host is the host of the SSH entry or the host of the task, it is empty for Fargate tasks
+	Host aws.Host
+	// Task is empty for SSH entries
+	Task aws.Task
+}
+
+func (server *FiberServer) registerExports() {
+	server.Get("/export/ssh", func(c *fiber.Ctx) error {
+		name, err := nameTemplate(c.Query("template", server.config.Exports.SSHNameTemplate))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		res, err := sshConfig(Filtered(server.clusters(), filterFromQuery(c)), name,
+			c.Query("user", server.config.Exports.SSHUser), c.Query("bastion", server.config.Exports.SSHBastion))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return c.SendString(res)
+	})
+
+	server.Get("/export/hosts", func(c *fiber.Ctx) error {
+		name, err := nameTemplate(c.Query("template", server.config.Exports.HostsNameTemplate))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		res, err := etcHosts(Filtered(server.clusters(), filterFromQuery(c)), name)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return c.SendString(res)
+	})
+}
+
+func nameTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultNameTemplate
+	}
+	return template.New("name").Option("missingkey=error").Parse(text)
+}
+
+// sshConfig renders Host entries for EC2 and external hosts of services, Fargate services have no hosts to connect to.
+// A host running several services gets an entry per service, hosts without IPv4 address are reached over IPv6.
+func sshConfig(clusters []aws.Cluster, name *template.Template, user string, bastion string) (string, error) {
+	var res strings.Builder
+	names := exportNames{}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			hosts := service.Hosts()
+			sort.Slice(hosts, func(i, j int) bool { return hosts[i].ID < hosts[j].ID })
+			for i, host := range hosts {
+				ip, ok := ansibleHostIP(host)
+				if !ok {
+					ip, ok = firstIPv6(host.Addresses)
+				}
+				if !ok {
+					continue
+				}
+				hostName, err := executeName(name, nameData(cluster, service, i, host, aws.Task{}))
+				if err != nil {
+					return "", err
+				}
+				hostName = names.unique(&res, hostName)
+
+				fmt.Fprintf(&res, "Host %s\n", hostName)
+				fmt.Fprintf(&res, "    HostName %s\n", ip)
+				if user != "" {
+					fmt.Fprintf(&res, "    User %s\n", user)
+				}
+				if bastion != "" {
+					fmt.Fprintf(&res, "    ProxyJump %s\n", bastion)
+				}
+				fmt.Fprintf(&res, "    # %s %s %s\n\n", cluster.Name, service.Name, host.ID)
+			}
+		}
+	}
+	return res.String(), nil
+}
+
+// etcHosts renders lines per task with its private IPv4 and its IPv6 addresses under the same name,
+// tasks in bridge network mode share the address of their host
+func etcHosts(clusters []aws.Cluster, name *template.Template) (string, error) {
+	var res strings.Builder
+	names := exportNames{}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			tasks := append([]aws.Task{}, service.Tasks...)
+			sort.Slice(tasks, func(i, j int) bool { return tasks[i].Arn < tasks[j].Arn })
+			for i, task := range tasks {
+				ips := aws.AddressStrings(task.Addresses, aws.AddressIPv6)
+				if address, ok := taskTargetAddress(task); ok {
+					ips = append([]string{address.IP.String()}, ips...)
+				}
+				if len(ips) == 0 {
+					continue
+				}
+				host := aws.Host{}
+				if task.Host != nil {
+					host = *task.Host
+				}
+				hostName, err := executeName(name, nameData(cluster, service, i, host, task))
+				if err != nil {
+					return "", err
+				}
+				hostName = names.unique(&res, hostName)
+				for _, ip := range ips {
+					fmt.Fprintf(&res, "%s\t%s\n", ip, hostName)
+				}
+			}
+		}
+	}
+	return res.String(), nil
+}
+
+// exportNames are names already written to an export, a template which does not tell entries apart,
+// e.g. without .Index, would give the same name to several of them
+type exportNames map[string]bool
+
+// unique returns the name, or the name with the first free number suffix when it is taken,
+// renames are reported in a comment as both formats ignore lines starting with #
+func (names exportNames) unique(w io.Writer, name string) string {
+	res := name
+	for i := 2; names[res]; i++ {
+		res = fmt.Sprintf("%s-%d", name, i)
+	}
+	if res != name {
+		fmt.Fprintf(w, "# %s is a duplicate name, renamed to %s\n", name, res)
+	}
+	names[res] = true
+	return res
+}
+
+func firstIPv6(addresses []aws.Address) (string, bool) {
+	ips := aws.AddressStrings(addresses, aws.AddressIPv6)
+	if len(ips) == 0 {
+		return "", false
+	}
+	return ips[0], true
+}
+
+func nameData(cluster aws.Cluster, service aws.Service, index int, host aws.Host, task aws.Task) NameData {
+	return NameData{
+		Service: service,
+		Cluster: cluster.Name,
+		Region:  cluster.Region,
+		Account: cluster.Account,
+		Index:   index + 1,
+		Host:    host,
+		Task:    task,
+	}
+}
+
+var (
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+	repeatedDashes   = regexp.MustCompile(`-{2,}`)
+)
+
+// executeName renders the name and makes it a valid host name, parts of the name may be empty, e.g. the env
+func executeName(name *template.Template, data NameData) (string, error) {
+	var buf bytes.Buffer
+	if err := name.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return hostName(buf.String()), nil
+}
+
+// hostName lowercases the value and replaces characters invalid in host names with dashes
+func hostName(value string) string {
+	res := invalidNameChars.ReplaceAllString(strings.ToLower(value), "-")
+	res = repeatedDashes.ReplaceAllString(res, "-")
+	labels := strings.Split(res, ".")
+	for i, label := range labels {
+		labels[i] = strings.Trim(label, "-")
+	}
+	return strings.Join(labels, ".")
+}
@@ -0,0 +1,318 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Filter holds the service filters selected in the UI or passed to the API
+type Filter struct {
+	App        string
+	Env        string
+	Cluster    string
+	Region     string
+	Account    string
+	LaunchType string
+	// Spot is "yes" to show only services which can be interrupted, "no" to hide them
+	Spot string
+	// IPVersion is "4" or "6" to show only services which have addresses of this family
+	IPVersion string
+	Vpc       string
+	Subnet    string
+	// Search is a free text, an IP address or a CIDR
+	Search string
+}
+
+// FilterOptions are values found in the inventory which can be selected in the filter form
+type FilterOptions struct {
+	Apps     []string
+	Envs     []string
+	Clusters []string
+	Regions  []string
+	Accounts []string
+	Vpcs     []VpcOption
+}
+
+func filterOptions(clusters []aws.Cluster) FilterOptions {
+	res := FilterOptions{
+		Apps:     appSlugs(clusters),
+		Envs:     envSlugs(clusters),
+		Clusters: []string{},
+		Regions:  []string{},
+		Accounts: []string{},
+		Vpcs:     vpcOptions(clusters),
+	}
+	for _, cluster := range clusters {
+		res.Clusters = appendUnique(res.Clusters, cluster.Name)
+		res.Regions = appendUnique(res.Regions, cluster.Region)
+		res.Accounts = appendUnique(res.Accounts, cluster.Account)
+	}
+	sort.Strings(res.Clusters)
+	sort.Strings(res.Regions)
+	sort.Strings(res.Accounts)
+	return res
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" || slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+func filterFromQuery(c *fiber.Ctx) Filter {
+	return Filter{
+		App:        c.Query("app"),
+		Env:        c.Query("env"),
+		Cluster:    c.Query("cluster"),
+		Region:     c.Query("region"),
+		Account:    c.Query("account"),
+		LaunchType: c.Query("launchType"),
+		Spot:       c.Query("spot"),
+		IPVersion:  c.Query("ipVersion"),
+		Vpc:        c.Query("vpc"),
+		Subnet:     c.Query("subnet"),
+		Search:     strings.TrimSpace(c.Query("q")),
+	}
+}
+
+func (filter Filter) values() map[string]string {
+	return map[string]string{
+		"app":        filter.App,
+		"env":        filter.Env,
+		"cluster":    filter.Cluster,
+		"region":     filter.Region,
+		"account":    filter.Account,
+		"launchType": filter.LaunchType,
+		"spot":       filter.Spot,
+		"ipVersion":  filter.IPVersion,
+		"vpc":        filter.Vpc,
+		"subnet":     filter.Subnet,
+		"q":          filter.Search,
+	}
+}
+
+// MatchCluster checks cluster level filters
+func (filter Filter) MatchCluster(cluster aws.Cluster) bool {
+	return (filter.Cluster == "" || cluster.Name == filter.Cluster) &&
+		(filter.Region == "" || cluster.Region == filter.Region) &&
+		(filter.Account == "" || cluster.Account == filter.Account)
+}
+
+func (filter Filter) Match(service aws.Service) bool {
+	if filter.App != "" && service.App != filter.App {
+		return false
+	}
+	if filter.Env != "" && service.Env != filter.Env {
+		return false
+	}
+	if filter.LaunchType != "" && !matchLaunchType(service, filter.LaunchType) {
+		return false
+	}
+	if filter.Spot == "yes" && !service.Spot() {
+		return false
+	}
+	if filter.Spot == "no" && service.Spot() {
+		return false
+	}
+	if filter.IPVersion != "" && !matchIPVersion(service.Addresses, filter.IPVersion) {
+		return false
+	}
+	if !filter.matchNetwork(service.Addresses) {
+		return false
+	}
+	if filter.Search != "" && !matchSearch(filter.Search, service.Addresses, service.Name, service.App, service.Env, service.Component, service.Image) {
+		return false
+	}
+	return true
+}
+
+// MatchTask checks a standalone task, such tasks do not belong to any app so they are hidden when app or env is selected
+func (filter Filter) MatchTask(task aws.Task) bool {
+	if filter.App != "" || filter.Env != "" {
+		return false
+	}
+	if filter.LaunchType != "" && task.LaunchType != filter.LaunchType {
+		return false
+	}
+	if filter.Spot == "yes" && !task.Spot {
+		return false
+	}
+	if filter.Spot == "no" && task.Spot {
+		return false
+	}
+	if filter.IPVersion != "" && !matchIPVersion(task.Addresses, filter.IPVersion) {
+		return false
+	}
+	if !filter.matchNetwork(task.Addresses) {
+		return false
+	}
+	if filter.Search != "" && !matchSearch(filter.Search, task.Addresses, task.Arn, task.Group, task.StartedBy) {
+		return false
+	}
+	return true
+}
+
+// MatchHost checks a container instance, hosts do not belong to any app so they are hidden when app or env is selected
+func (filter Filter) MatchHost(host aws.Host) bool {
+	if filter.App != "" || filter.Env != "" {
+		return false
+	}
+	if filter.LaunchType == "FARGATE" || (filter.LaunchType == "EC2" && host.External) || (filter.LaunchType == "EXTERNAL" && !host.External) {
+		return false
+	}
+	if (filter.Spot == "yes" && !host.Spot) || (filter.Spot == "no" && host.Spot) {
+		return false
+	}
+	if filter.IPVersion != "" && !matchIPVersion(host.Addresses, filter.IPVersion) {
+		return false
+	}
+	if !filter.matchNetwork(host.Addresses) {
+		return false
+	}
+	if filter.Search != "" && !matchSearch(filter.Search, host.Addresses, host.ID, host.Hostname) {
+		return false
+	}
+	return true
+}
+
+// MatchAddress checks address level filters, it is used where items are addresses rather than their owners.
+// Free text which is not an IP address or a CIDR matches the owner, so every address passes it.
+func (filter Filter) MatchAddress(address aws.Address) bool {
+	addresses := []aws.Address{address}
+	if filter.IPVersion != "" && !matchIPVersion(addresses, filter.IPVersion) {
+		return false
+	}
+	if !filter.matchNetwork(addresses) {
+		return false
+	}
+	if _, err := netip.ParseAddr(filter.Search); err == nil {
+		return matchSearch(filter.Search, addresses)
+	}
+	if _, err := netip.ParsePrefix(filter.Search); err == nil {
+		return matchSearch(filter.Search, addresses)
+	}
+	return true
+}
+
+// matchNetwork checks that some of the addresses are in the selected VPC and subnet
+func (filter Filter) matchNetwork(addresses []aws.Address) bool {
+	if filter.Vpc == "" && filter.Subnet == "" {
+		return true
+	}
+	return slices.ContainsFunc(addresses, func(address aws.Address) bool {
+		return (filter.Vpc == "" || address.VpcID == filter.Vpc) && (filter.Subnet == "" || address.SubnetID == filter.Subnet)
+	})
+}
+
+func matchIPVersion(addresses []aws.Address, version string) bool {
+	for _, address := range addresses {
+		if (version == "4" && address.IP.Is4()) || (version == "6" && address.IP.Is6()) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSearch checks addresses when the search is an IP address or a CIDR, so any IPv6 notation works,
+// otherwise it looks for a substring in the addresses and in the fields
+func matchSearch(search string, addresses []aws.Address, fields ...string) bool {
+	if ip, err := netip.ParseAddr(search); err == nil {
+		return slices.ContainsFunc(addresses, func(address aws.Address) bool {
+			return address.IP == ip.Unmap()
+		})
+	}
+	if prefix, err := netip.ParsePrefix(search); err == nil {
+		return slices.ContainsFunc(addresses, func(address aws.Address) bool {
+			return prefix.Contains(address.IP)
+		})
+	}
+	search = strings.ToLower(search)
+	for _, address := range addresses {
+		fields = append(fields, address.IP.String())
+	}
+	return slices.ContainsFunc(fields, func(field string) bool {
+		return strings.Contains(strings.ToLower(field), search)
+	})
+}
+
+// matchLaunchType checks the launch type of the service or any of its tasks,
+// tasks of a service with capacity provider strategy have launch type while the service does not
+func matchLaunchType(service aws.Service, launchType string) bool {
+	if service.LaunchType == launchType {
+		return true
+	}
+	for _, task := range service.Tasks {
+		if task.LaunchType == launchType {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns query string of the filter with one value replaced, it is used to build filter links
+func (filter Filter) Query(key string, value string) string {
+	values := url.Values{}
+	for k, v := range filter.values() {
+		if v != "" {
+			values.Set(k, v)
+		}
+	}
+	if value == "" {
+		values.Del(key)
+	} else {
+		values.Set(key, value)
+	}
+	if len(values) == 0 {
+		return "/"
+	}
+	return "/?" + values.Encode()
+}
+
+// Filtered returns clusters with services, standalone tasks and hosts matching the filter, empty clusters are skipped
+func Filtered(clusters []aws.Cluster, filter Filter) []aws.Cluster {
+	res := []aws.Cluster{}
+	for _, cluster := range clusters {
+		if !filter.MatchCluster(cluster) {
+			continue
+		}
+		services := []aws.Service{}
+		for _, service := range cluster.Services {
+			if filter.Match(service) {
+				services = append(services, service)
+			}
+		}
+		taskGroups := []aws.TaskGroup{}
+		for _, group := range cluster.TaskGroups {
+			tasks := []aws.Task{}
+			for _, task := range group.Tasks {
+				if filter.MatchTask(task) {
+					tasks = append(tasks, task)
+				}
+			}
+			if len(tasks) > 0 {
+				group.Tasks = tasks
+				taskGroups = append(taskGroups, group)
+			}
+		}
+		hosts := []aws.Host{}
+		for _, host := range cluster.Hosts {
+			if filter.MatchHost(host) {
+				hosts = append(hosts, host)
+			}
+		}
+		if len(services) > 0 || len(taskGroups) > 0 || len(hosts) > 0 {
+			cluster.Services = services
+			cluster.TaskGroups = taskGroups
+			cluster.Hosts = hosts
+			res = append(res, cluster)
+		}
+	}
+	return res
+}
@@ -0,0 +1,393 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"encoding/json"
+	"log"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/graphql-go/graphql"
+)
+
+// graphQLRequest is the body of a GraphQL POST request, GET requests pass the same fields in the query
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphQLAccount groups clusters of one account, it is the root of nested queries
+type graphQLAccount struct {
+	ID       string
+	Clusters []aws.Cluster
+}
+
+// registerGraphQL adds the GraphQL endpoint, GET without query opens the playground
+func (server *FiberServer) registerGraphQL() {
+	schema, err := graphQLSchema()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	execute := func(c *fiber.Ctx, request graphQLRequest) error {
+		return c.JSON(graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  request.Query,
+			OperationName:  request.OperationName,
+			VariableValues: request.Variables,
+			RootObject:     map[string]any{"clusters": server.clusters()},
+			Context:        c.UserContext(),
+		}))
+	}
+
+	server.Get("/graphql", func(c *fiber.Ctx) error {
+		request := graphQLRequest{
+			Query:         c.Query("query"),
+			OperationName: c.Query("operationName"),
+		}
+		if request.Query == "" {
+			return Render(c, GraphQLPage())
+		}
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "variables must be a JSON object")
+			}
+		}
+		return execute(c, request)
+	})
+
+	server.Post("/graphql", func(c *fiber.Ctx) error {
+		request := graphQLRequest{}
+		if err := c.BodyParser(&request); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return execute(c, request)
+	})
+}
+
+// filter arguments, the same names as query parameters of the page and the REST API
+var (
+	clusterArgs = graphql.FieldConfigArgument{
+		"name":    &graphql.ArgumentConfig{Type: graphql.String},
+		"region":  &graphql.ArgumentConfig{Type: graphql.String},
+		"account": &graphql.ArgumentConfig{Type: graphql.String},
+	}
+	serviceArgs = graphql.FieldConfigArgument{
+		"name":       &graphql.ArgumentConfig{Type: graphql.String},
+		"app":        &graphql.ArgumentConfig{Type: graphql.String},
+		"env":        &graphql.ArgumentConfig{Type: graphql.String},
+		"component":  &graphql.ArgumentConfig{Type: graphql.String},
+		"launchType": &graphql.ArgumentConfig{Type: graphql.String},
+		"spot":       &graphql.ArgumentConfig{Type: graphql.Boolean},
+		"ipVersion":  &graphql.ArgumentConfig{Type: graphql.String, Description: "IP version, 4 or 6"},
+		"vpc":        &graphql.ArgumentConfig{Type: graphql.String},
+		"subnet":     &graphql.ArgumentConfig{Type: graphql.String},
+		"q":          &graphql.ArgumentConfig{Type: graphql.String, Description: "Free text, IP address or CIDR"},
+	}
+	taskArgs = graphql.FieldConfigArgument{
+		"launchType": &graphql.ArgumentConfig{Type: graphql.String},
+		"spot":       &graphql.ArgumentConfig{Type: graphql.Boolean},
+		"ipVersion":  &graphql.ArgumentConfig{Type: graphql.String, Description: "IP version, 4 or 6"},
+		"vpc":        &graphql.ArgumentConfig{Type: graphql.String},
+		"subnet":     &graphql.ArgumentConfig{Type: graphql.String},
+		"q":          &graphql.ArgumentConfig{Type: graphql.String, Description: "Free text, IP address or CIDR"},
+	}
+	addressArgs = graphql.FieldConfigArgument{
+		"kind":      &graphql.ArgumentConfig{Type: graphql.String, Description: "private, public, elastic or ipv6"},
+		"ipVersion": &graphql.ArgumentConfig{Type: graphql.String, Description: "IP version, 4 or 6"},
+		"vpc":       &graphql.ArgumentConfig{Type: graphql.String},
+		"subnet":    &graphql.ArgumentConfig{Type: graphql.String},
+	}
+)
+
+// filterFromArgs converts GraphQL arguments to the filter used by the page
+func filterFromArgs(args map[string]any) Filter {
+	str := func(key string) string {
+		value, _ := args[key].(string)
+		return value
+	}
+	res := Filter{
+		Cluster:    str("name"),
+		Region:     str("region"),
+		Account:    str("account"),
+		App:        str("app"),
+		Env:        str("env"),
+		LaunchType: str("launchType"),
+		IPVersion:  str("ipVersion"),
+		Vpc:        str("vpc"),
+		Subnet:     str("subnet"),
+		Search:     str("q"),
+	}
+	if spot, ok := args["spot"].(bool); ok {
+		res.Spot = "no"
+		if spot {
+			res.Spot = "yes"
+		}
+	}
+	return res
+}
+
+func graphQLSchema() (graphql.Schema, error) {
+	addressType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Address",
+		Fields: graphql.Fields{
+			"ip": &graphql.Field{Type: graphql.String},
+			"kind": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return string(p.Source.(aws.Address).Kind), nil
+			}},
+			"vpcId":      &graphql.Field{Type: graphql.String},
+			"vpcName":    &graphql.Field{Type: graphql.String},
+			"subnetId":   &graphql.Field{Type: graphql.String},
+			"subnetName": &graphql.Field{Type: graphql.String},
+			"subnetCidr": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				// public addresses have no subnet CIDR
+				cidr := p.Source.(aws.Address).SubnetCIDR
+				if !cidr.IsValid() {
+					return nil, nil
+				}
+				return cidr.String(), nil
+			}},
+			"availabilityZone": &graphql.Field{Type: graphql.String},
+			"eniId":            &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	addressesField := func(addresses func(source any) []aws.Address) *graphql.Field {
+		return &graphql.Field{
+			Type: graphql.NewList(addressType),
+			Args: addressArgs,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				filter := filterFromArgs(p.Args)
+				kind, _ := p.Args["kind"].(string)
+				res := []aws.Address{}
+				for _, address := range addresses(p.Source) {
+					if (kind == "" || string(address.Kind) == kind) &&
+						(filter.IPVersion == "" || matchIPVersion([]aws.Address{address}, filter.IPVersion)) &&
+						filter.matchNetwork([]aws.Address{address}) {
+						res = append(res, address)
+					}
+				}
+				return res, nil
+			},
+		}
+	}
+
+	hostType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Host",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: graphql.String},
+			"hostname": &graphql.Field{Type: graphql.String},
+			"external": &graphql.Field{Type: graphql.Boolean},
+			"spot":     &graphql.Field{Type: graphql.Boolean},
+			"addresses": addressesField(func(source any) []aws.Address {
+				return source.(aws.Host).Addresses
+			}),
+		},
+	})
+
+	taskType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Task",
+		Fields: graphql.Fields{
+			"arn":              &graphql.Field{Type: graphql.String},
+			"group":            &graphql.Field{Type: graphql.String},
+			"startedBy":        &graphql.Field{Type: graphql.String},
+			"launchType":       &graphql.Field{Type: graphql.String},
+			"capacityProvider": &graphql.Field{Type: graphql.String},
+			"platformVersion":  &graphql.Field{Type: graphql.String},
+			"spot":             &graphql.Field{Type: graphql.Boolean},
+			"containers":       &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"host": &graphql.Field{Type: hostType, Resolve: func(p graphql.ResolveParams) (any, error) {
+				// Fargate tasks have no host
+				if host := p.Source.(aws.Task).Host; host != nil {
+					return *host, nil
+				}
+				return nil, nil
+			}},
+			"addresses": addressesField(func(source any) []aws.Address {
+				return source.(aws.Task).Addresses
+			}),
+		},
+	})
+
+	tasksField := func(tasks func(source any) []aws.Task) *graphql.Field {
+		return &graphql.Field{
+			Type: graphql.NewList(taskType),
+			Args: taskArgs,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				filter := filterFromArgs(p.Args)
+				res := []aws.Task{}
+				for _, task := range tasks(p.Source) {
+					if filter.MatchTask(task) {
+						res = append(res, task)
+					}
+				}
+				return res, nil
+			},
+		}
+	}
+
+	capacityProviderType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "CapacityProvider",
+		Fields: graphql.Fields{
+			"name":   &graphql.Field{Type: graphql.String},
+			"weight": &graphql.Field{Type: graphql.Int},
+			"base":   &graphql.Field{Type: graphql.Int},
+		},
+	})
+
+	serviceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Service",
+		Fields: graphql.Fields{
+			"name":      &graphql.Field{Type: graphql.String},
+			"image":     &graphql.Field{Type: graphql.String},
+			"app":       &graphql.Field{Type: graphql.String},
+			"env":       &graphql.Field{Type: graphql.String},
+			"component": &graphql.Field{Type: graphql.String},
+			"container": &graphql.Field{Type: graphql.String},
+			"version":   &graphql.Field{Type: graphql.String},
+			"taskDefinition": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(aws.Service).TaskDefinition.Arn, nil
+			}},
+			"launchType":        &graphql.Field{Type: graphql.String},
+			"capacityProviders": &graphql.Field{Type: graphql.NewList(capacityProviderType)},
+			"platformVersion":   &graphql.Field{Type: graphql.String},
+			"spot": &graphql.Field{Type: graphql.Boolean, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(aws.Service).Spot(), nil
+			}},
+			"hosts": &graphql.Field{Type: graphql.NewList(hostType), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(aws.Service).Hosts(), nil
+			}},
+			"desiredCount": &graphql.Field{Type: graphql.Int},
+			"runningCount": &graphql.Field{Type: graphql.Int},
+			"pendingCount": &graphql.Field{Type: graphql.Int},
+			"rolloutState": &graphql.Field{Type: graphql.String},
+			"tasks": tasksField(func(source any) []aws.Task {
+				return source.(aws.Service).Tasks
+			}),
+			"addresses": addressesField(func(source any) []aws.Address {
+				return source.(aws.Service).Addresses
+			}),
+		},
+	})
+
+	servicesField := func(clusters func(source any) []aws.Cluster) *graphql.Field {
+		return &graphql.Field{
+			Type: graphql.NewList(serviceType),
+			Args: serviceArgs,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				filter := filterFromArgs(p.Args)
+				// name argument is the service name on this level
+				name := filter.Cluster
+				filter.Cluster = ""
+				component, _ := p.Args["component"].(string)
+				res := []aws.Service{}
+				for _, cluster := range clusters(p.Source) {
+					for _, service := range cluster.Services {
+						if (name == "" || service.Name == name) && (component == "" || service.Component == component) && filter.Match(service) {
+							res = append(res, service)
+						}
+					}
+				}
+				return res, nil
+			},
+		}
+	}
+
+	clusterType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Cluster",
+		Fields: graphql.Fields{
+			"arn":     &graphql.Field{Type: graphql.String},
+			"name":    &graphql.Field{Type: graphql.String},
+			"region":  &graphql.Field{Type: graphql.String},
+			"account": &graphql.Field{Type: graphql.String},
+			"services": servicesField(func(source any) []aws.Cluster {
+				return []aws.Cluster{source.(aws.Cluster)}
+			}),
+			"tasks": tasksField(func(source any) []aws.Task {
+				// standalone tasks which do not belong to any service
+				res := []aws.Task{}
+				for _, group := range source.(aws.Cluster).TaskGroups {
+					res = append(res, group.Tasks...)
+				}
+				return res
+			}),
+			"hosts": &graphql.Field{
+				Type: graphql.NewList(hostType),
+				Args: taskArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					filter := filterFromArgs(p.Args)
+					res := []aws.Host{}
+					for _, host := range p.Source.(aws.Cluster).Hosts {
+						if filter.MatchHost(host) {
+							res = append(res, host)
+						}
+					}
+					return res, nil
+				},
+			},
+		},
+	})
+
+	clustersField := func(clusters func(source any) []aws.Cluster) *graphql.Field {
+		return &graphql.Field{
+			Type: graphql.NewList(clusterType),
+			Args: clusterArgs,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				filter := filterFromArgs(p.Args)
+				res := []aws.Cluster{}
+				for _, cluster := range clusters(p.Source) {
+					if filter.MatchCluster(cluster) {
+						res = append(res, cluster)
+					}
+				}
+				return res, nil
+			},
+		}
+	}
+
+	accountType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Account",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{Type: graphql.String},
+			"clusters": clustersField(func(source any) []aws.Cluster {
+				return source.(graphQLAccount).Clusters
+			}),
+		},
+	})
+
+	rootClusters := func(source any) []aws.Cluster {
+		return source.(map[string]any)["clusters"].([]aws.Cluster)
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"accounts": &graphql.Field{
+				Type: graphql.NewList(accountType),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, _ := p.Args["id"].(string)
+					accounts := map[string][]aws.Cluster{}
+					for _, cluster := range rootClusters(p.Source) {
+						if id == "" || cluster.Account == id {
+							accounts[cluster.Account] = append(accounts[cluster.Account], cluster)
+						}
+					}
+					res := []graphQLAccount{}
+					for account, clusters := range accounts {
+						res = append(res, graphQLAccount{ID: account, Clusters: clusters})
+					}
+					sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+					return res, nil
+				},
+			},
+			"clusters": clustersField(rootClusters),
+			"services": servicesField(rootClusters),
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
@@ -0,0 +1,308 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"ecs-ip/internal/aws"
+	inventoryv1 "ecs-ip/pkg/inventory/v1"
+	"encoding/base64"
+
+	"github.com/samber/lo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer returns the gRPC server of the inventory, it shares the cached snapshot with the web server
+// and expects the same basic auth credentials in the authorization metadata
+func (server *FiberServer) GRPCServer() *grpc.Server {
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:"+server.config.Password))
+	auth := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			if subtle.ConstantTimeCompare([]byte(value), []byte(expected)) == 1 {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+
+	res := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := auth(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := auth(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	inventoryv1.RegisterInventoryServiceServer(res, &inventoryServer{cache: server.cache})
+	return res
+}
+
+type inventoryServer struct {
+	inventoryv1.UnimplementedInventoryServiceServer
+	cache *snapshotCache
+}
+
+func (server *inventoryServer) ListServices(_ context.Context, req *inventoryv1.ListServicesRequest) (*inventoryv1.ListServicesResponse, error) {
+	if req.Limit < 0 || req.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and offset must not be negative")
+	}
+	items := serviceItems(Filtered(server.cache.get().Clusters, filterFromProto(req.Filter)))
+	res := &inventoryv1.ListServicesResponse{Total: int32(len(items))}
+
+	limit := len(items)
+	if req.Limit > 0 {
+		limit = int(req.Limit)
+	}
+	for _, item := range page(items, limit, int(req.Offset)).Items {
+		res.Services = append(res.Services, protoService(item))
+	}
+	return res, nil
+}
+
+func (server *inventoryServer) LookupIP(_ context.Context, req *inventoryv1.LookupIPRequest) (*inventoryv1.LookupIPResponse, error) {
+	owners, err := server.cache.addressIndex().Lookup(req.Query)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &inventoryv1.LookupIPResponse{
+		Owners: lo.Map(owners, func(owner Owner, _ int) *inventoryv1.Owner {
+			return &inventoryv1.Owner{
+				Address:    protoAddress(owner.Address, 0),
+				Account:    owner.Account,
+				Region:     owner.Region,
+				Cluster:    owner.Cluster,
+				Service:    owner.Service,
+				Task:       owner.Task,
+				Containers: owner.Containers,
+				Host:       owner.Host,
+			}
+		}),
+	}, nil
+}
+
+// Watch sends changes of services and task groups which match the filter,
+// removed items are matched by their last known state. Items which start or stop matching
+// because of a change are sent as added or removed, so the client's view follows the filter.
+func (server *inventoryServer) Watch(req *inventoryv1.WatchRequest, stream inventoryv1.InventoryService_WatchServer) error {
+	filter := filterFromProto(req.Filter)
+	// subscribe before reading the snapshot so no change is missed in between
+	changes, unsubscribe := server.cache.subscribe()
+	defer unsubscribe()
+
+	// matching are IDs of items which match the filter as the client last saw them
+	matching := map[string]bool{}
+	for _, cluster := range Filtered(server.cache.get().Clusters, filter) {
+		for _, service := range cluster.Services {
+			change := Change{Kind: ServiceAdded, ID: serviceRowID(cluster, service), Cluster: cluster, Service: lo.ToPtr(service)}
+			matching[change.ID] = true
+			if req.SendInitial {
+				if err := stream.Send(protoChange(change)); err != nil {
+					return err
+				}
+			}
+		}
+		for _, group := range cluster.TaskGroups {
+			change := Change{Kind: TaskGroupAdded, ID: taskGroupRowID(cluster, group), Cluster: cluster, TaskGroup: lo.ToPtr(group)}
+			matching[change.ID] = true
+			if req.SendInitial {
+				if err := stream.Send(protoChange(change)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case batch := <-changes:
+			for _, change := range batch {
+				change, ok := watchChange(change, filter, matching)
+				if !ok {
+					continue
+				}
+				if err := stream.Send(protoChange(change)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// watchChange applies the filter to the changed item and updates matching IDs, a changed item which no longer
+// matches is removed for the client and a changed item which starts to match is added
+func watchChange(change Change, filter Filter, matching map[string]bool) (Change, bool) {
+	matched, ok := matchChange(change, filter)
+	was := matching[change.ID]
+	switch {
+	case change.Removed():
+		delete(matching, change.ID)
+		return matched, ok || was
+	case ok:
+		matching[change.ID] = true
+		if !was && matched.Kind == ServiceChanged {
+			matched.Kind = ServiceAdded
+		}
+		if !was && matched.Kind == TaskGroupChanged {
+			matched.Kind = TaskGroupAdded
+		}
+		return matched, true
+	case was:
+		delete(matching, change.ID)
+		// the removed item is sent in its new state with the changed fields, which tell why it no longer matches
+		if change.Service != nil {
+			change.Kind = ServiceRemoved
+		} else {
+			change.Kind = TaskGroupRemoved
+		}
+		return change, true
+	default:
+		return change, false
+	}
+}
+
+// matchChange applies the filter to the changed item, tasks of a task group are filtered one by one like on the page
+func matchChange(change Change, filter Filter) (Change, bool) {
+	if !filter.MatchCluster(change.Cluster) {
+		return change, false
+	}
+	if change.Service != nil {
+		return change, filter.Match(*change.Service)
+	}
+	group := *change.TaskGroup
+	group.Tasks = lo.Filter(group.Tasks, func(task aws.Task, _ int) bool { return filter.MatchTask(task) })
+	change.TaskGroup = &group
+	return change, len(group.Tasks) > 0
+}
+
+func filterFromProto(filter *inventoryv1.Filter) Filter {
+	return Filter{
+		App:        filter.GetApp(),
+		Env:        filter.GetEnv(),
+		Cluster:    filter.GetCluster(),
+		Region:     filter.GetRegion(),
+		Account:    filter.GetAccount(),
+		LaunchType: filter.GetLaunchType(),
+		Spot:       filter.GetSpot(),
+		IPVersion:  filter.GetIpVersion(),
+		Vpc:        filter.GetVpc(),
+		Subnet:     filter.GetSubnet(),
+		Search:     filter.GetSearch(),
+	}
+}
+
+var protoChangeKinds = map[ChangeKind]inventoryv1.ChangeKind{
+	ServiceAdded:     inventoryv1.ChangeKind_CHANGE_KIND_SERVICE_ADDED,
+	ServiceRemoved:   inventoryv1.ChangeKind_CHANGE_KIND_SERVICE_REMOVED,
+	ServiceChanged:   inventoryv1.ChangeKind_CHANGE_KIND_SERVICE_CHANGED,
+	TaskGroupAdded:   inventoryv1.ChangeKind_CHANGE_KIND_TASK_GROUP_ADDED,
+	TaskGroupRemoved: inventoryv1.ChangeKind_CHANGE_KIND_TASK_GROUP_REMOVED,
+	TaskGroupChanged: inventoryv1.ChangeKind_CHANGE_KIND_TASK_GROUP_CHANGED,
+}
+
+func protoChange(change Change) *inventoryv1.WatchResponse {
+	res := &inventoryv1.WatchResponse{
+		Kind:   protoChangeKinds[change.Kind],
+		Id:     change.ID,
+		Fields: change.Fields,
+	}
+	if change.Service != nil {
+		res.Item = &inventoryv1.WatchResponse_Service{Service: protoService(ServiceItem{
+			Cluster: change.Cluster.Name,
+			Region:  change.Cluster.Region,
+			Account: change.Cluster.Account,
+			Service: *change.Service,
+		})}
+	}
+	if change.TaskGroup != nil {
+		res.Item = &inventoryv1.WatchResponse_TaskGroup{TaskGroup: &inventoryv1.TaskGroup{
+			Cluster:   change.Cluster.Name,
+			Region:    change.Cluster.Region,
+			Account:   change.Cluster.Account,
+			Group:     change.TaskGroup.Group,
+			StartedBy: change.TaskGroup.StartedBy,
+			Tasks:     lo.Map(change.TaskGroup.Tasks, protoTask),
+		}}
+	}
+	return res
+}
+
+func protoService(item ServiceItem) *inventoryv1.Service {
+	return &inventoryv1.Service{
+		Cluster:        item.Cluster,
+		Region:         item.Region,
+		Account:        item.Account,
+		Name:           item.Name,
+		Image:          item.Image,
+		App:            item.App,
+		Env:            item.Env,
+		Component:      item.Component,
+		Container:      item.Container,
+		Version:        item.Version,
+		TaskDefinition: item.TaskDefinition.Arn,
+		LaunchType:     item.LaunchType,
+		CapacityProviders: lo.Map(item.CapacityProviders, func(provider aws.CapacityProvider, _ int) *inventoryv1.CapacityProvider {
+			return &inventoryv1.CapacityProvider{Name: provider.Name, Weight: provider.Weight, Base: provider.Base}
+		}),
+		PlatformVersion: item.PlatformVersion,
+		Spot:            item.Spot(),
+		DesiredCount:    item.DesiredCount,
+		RunningCount:    item.RunningCount,
+		PendingCount:    item.PendingCount,
+		RolloutState:    item.RolloutState,
+		Addresses:       lo.Map(item.Addresses, protoAddress),
+		Tasks:           lo.Map(item.Tasks, protoTask),
+	}
+}
+
+func protoTask(task aws.Task, _ int) *inventoryv1.Task {
+	res := &inventoryv1.Task{
+		Arn:              task.Arn,
+		Group:            task.Group,
+		StartedBy:        task.StartedBy,
+		LaunchType:       task.LaunchType,
+		CapacityProvider: task.CapacityProvider,
+		PlatformVersion:  task.PlatformVersion,
+		Spot:             task.Spot,
+		Containers:       task.Containers,
+		Addresses:        lo.Map(task.Addresses, protoAddress),
+	}
+	if task.Host != nil {
+		res.Host = &inventoryv1.Host{
+			Id:        task.Host.ID,
+			Hostname:  task.Host.Hostname,
+			External:  task.Host.External,
+			Spot:      task.Host.Spot,
+			Addresses: lo.Map(task.Host.Addresses, protoAddress),
+		}
+	}
+	return res
+}
+
+func protoAddress(address aws.Address, _ int) *inventoryv1.Address {
+	res := &inventoryv1.Address{
+		Ip:               address.IP.String(),
+		Kind:             string(address.Kind),
+		VpcId:            address.VpcID,
+		VpcName:          address.VpcName,
+		SubnetId:         address.SubnetID,
+		SubnetName:       address.SubnetName,
+		AvailabilityZone: address.AvailabilityZone,
+		EniId:            address.EniID,
+	}
+	// public addresses have no subnet CIDR
+	if address.SubnetCIDR.IsValid() {
+		res.SubnetCidr = address.SubnetCIDR.String()
+	}
+	return res
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"testing"
+)
+
+func TestWatchChange(t *testing.T) {
+	cluster := aws.Cluster{Arn: "arn:aws:ecs:eu-west-1:123456789012:cluster/main", Name: "main"}
+	prod := &aws.Service{Name: "web", Env: "prod"}
+	staging := &aws.Service{Name: "web", Env: "staging"}
+	filter := Filter{Env: "prod"}
+	id := serviceRowID(cluster, *prod)
+
+	spot := &aws.TaskGroup{Group: "family:batch", Tasks: []aws.Task{{Arn: "task/1", Spot: true}}}
+	onDemand := &aws.TaskGroup{Group: "family:batch", Tasks: []aws.Task{{Arn: "task/1"}}}
+	spotFilter := Filter{Spot: "yes"}
+	groupID := taskGroupRowID(cluster, *spot)
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		change   Change
+		matching bool
+		// kind is the sent kind, empty when nothing is sent
+		kind          ChangeKind
+		matchingAfter bool
+	}{
+		{"enters the filter", filter, Change{Kind: ServiceChanged, ID: id, Cluster: cluster, Service: prod}, false, ServiceAdded, true},
+		{"leaves the filter", filter, Change{Kind: ServiceChanged, ID: id, Cluster: cluster, Service: staging}, true, ServiceRemoved, false},
+		{"changes within the filter", filter, Change{Kind: ServiceChanged, ID: id, Cluster: cluster, Service: prod}, true, ServiceChanged, true},
+		{"changes outside the filter", filter, Change{Kind: ServiceChanged, ID: id, Cluster: cluster, Service: staging}, false, "", false},
+		{"added within the filter", filter, Change{Kind: ServiceAdded, ID: id, Cluster: cluster, Service: prod}, false, ServiceAdded, true},
+		{"added outside the filter", filter, Change{Kind: ServiceAdded, ID: id, Cluster: cluster, Service: staging}, false, "", false},
+		{"removed within the filter", filter, Change{Kind: ServiceRemoved, ID: id, Cluster: cluster, Service: prod}, true, ServiceRemoved, false},
+		{"removed outside the filter", filter, Change{Kind: ServiceRemoved, ID: id, Cluster: cluster, Service: staging}, false, "", false},
+		{"task group enters the filter", spotFilter, Change{Kind: TaskGroupChanged, ID: groupID, Cluster: cluster, TaskGroup: spot}, false, TaskGroupAdded, true},
+		{"task group leaves the filter", spotFilter, Change{Kind: TaskGroupChanged, ID: groupID, Cluster: cluster, TaskGroup: onDemand}, true, TaskGroupRemoved, false},
+		{"task group changes within the filter", spotFilter, Change{Kind: TaskGroupChanged, ID: groupID, Cluster: cluster, TaskGroup: spot}, true, TaskGroupChanged, true},
+		{"task group changes outside the filter", spotFilter, Change{Kind: TaskGroupChanged, ID: groupID, Cluster: cluster, TaskGroup: onDemand}, false, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matching := map[string]bool{}
+			if test.matching {
+				matching[test.change.ID] = true
+			}
+			change, ok := watchChange(test.change, test.filter, matching)
+			switch {
+			case ok && test.kind == "":
+				t.Errorf("sent %s, want nothing", change.Kind)
+			case !ok && test.kind != "":
+				t.Errorf("sent nothing, want %s", test.kind)
+			case ok && change.Kind != test.kind:
+				t.Errorf("sent %s, want %s", change.Kind, test.kind)
+			}
+			if matching[test.change.ID] != test.matchingAfter {
+				t.Errorf("matching after the change is %v, want %v", matching[test.change.ID], test.matchingAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Owner describes what an address belongs to, service and task are empty for hosts without tasks
+// and service is empty for standalone tasks
+type Owner struct {
+	Address    aws.Address `json:"address"`
+	Account    string      `json:"account"`
+	Region     string      `json:"region"`
+	Cluster    string      `json:"cluster"`
+	Service    string      `json:"service"`
+	Task       string      `json:"task"`
+	Containers []string    `json:"containers"`
+	Host       string      `json:"host"`
+}
+
+// AddressIndex allows to find owners of addresses of the crawled inventory
+type AddressIndex struct {
+	// owners are sorted by address to return CIDR lookup results in order
+	owners []Owner
+}
+
+func newAddressIndex(clusters []aws.Cluster) *AddressIndex {
+	index := &AddressIndex{owners: []Owner{}}
+	for _, cluster := range clusters {
+		base := Owner{
+			Account: cluster.Account,
+			Region:  cluster.Region,
+			Cluster: cluster.Name,
+		}
+		for _, service := range cluster.Services {
+			for _, task := range service.Tasks {
+				owner := base
+				owner.Service = service.Name
+				index.addTask(owner, task)
+			}
+		}
+		for _, group := range cluster.TaskGroups {
+			for _, task := range group.Tasks {
+				index.addTask(base, task)
+			}
+		}
+		for _, host := range cluster.Hosts {
+			owner := base
+			owner.Host = host.ID
+			index.add(owner, host.Addresses)
+		}
+	}
+	sort.SliceStable(index.owners, func(i, j int) bool {
+		return index.owners[i].Address.IP.Less(index.owners[j].Address.IP)
+	})
+	return index
+}
+
+func (index *AddressIndex) addTask(owner Owner, task aws.Task) {
+	owner.Task = task.Arn
+	owner.Containers = task.Containers
+	if task.Host != nil {
+		owner.Host = task.Host.ID
+	}
+	index.add(owner, task.Addresses)
+}
+
+func (index *AddressIndex) add(owner Owner, addresses []aws.Address) {
+	for _, address := range addresses {
+		owner.Address = address
+		index.owners = append(index.owners, owner)
+	}
+}
+
+// Lookup returns owners of the IP address or of all addresses inside the CIDR
+func (index *AddressIndex) Lookup(query string) ([]Owner, error) {
+	prefix, err := parsePrefix(query)
+	if err != nil {
+		return nil, err
+	}
+	// owners are sorted, so the first address of the prefix is found with binary search
+	start := sort.Search(len(index.owners), func(i int) bool {
+		return !index.owners[i].Address.IP.Less(prefix.Masked().Addr())
+	})
+	res := []Owner{}
+	for _, owner := range index.owners[start:] {
+		if !prefix.Contains(owner.Address.IP) {
+			break
+		}
+		res = append(res, owner)
+	}
+	return res, nil
+}
+
+// parsePrefix accepts an IP address or a CIDR, an address is converted to a single address prefix
+func parsePrefix(query string) (netip.Prefix, error) {
+	query = strings.TrimSpace(query)
+	if strings.Contains(query, "/") {
+		prefix, err := netip.ParsePrefix(query)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q: %w", query, err)
+		}
+		return prefix.Masked(), nil
+	}
+	ip, err := netip.ParseAddr(query)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address %q: %w", query, err)
+	}
+	ip = ip.Unmap()
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"slices"
+	"sort"
+)
+
+// envOrder is the order in which versions are promoted between environments, unknown environments go last
+var envOrder = []string{"dev", "dev2", "development", "ci", "main", "stage", "staging", "prod"}
+
+// VersionMatrix shows running versions with one row per App/Component and one column per Env
+type VersionMatrix struct {
+	Envs []string
+	Rows []MatrixRow
+}
+
+type MatrixRow struct {
+	App       string
+	Component string
+	// Cells are in the same order as VersionMatrix.Envs
+	Cells []MatrixCell
+}
+
+type MatrixCell struct {
+	Versions []string
+	// Mixed is set when several versions are running in the same environment
+	Mixed bool
+	// Lagging is set when the environment does not run the version of the first environment in the promotion order
+	Lagging bool
+}
+
+func versionMatrix(clusters []aws.Cluster) VersionMatrix {
+	envs := envSlugs(clusters)
+	sort.SliceStable(envs, func(i, j int) bool {
+		return envRank(envs[i]) < envRank(envs[j])
+	})
+
+	type rowKey struct {
+		app       string
+		component string
+	}
+	versions := map[rowKey]map[string][]string{}
+	keys := []rowKey{}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			if service.Env == "" {
+				continue
+			}
+			key := rowKey{app: service.App, component: service.Component}
+			if _, ok := versions[key]; !ok {
+				versions[key] = map[string][]string{}
+				keys = append(keys, key)
+			}
+			if !slices.Contains(versions[key][service.Env], service.Version) {
+				versions[key][service.Env] = append(versions[key][service.Env], service.Version)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].app != keys[j].app {
+			return keys[i].app < keys[j].app
+		}
+		return keys[i].component < keys[j].component
+	})
+
+	res := VersionMatrix{Envs: envs, Rows: []MatrixRow{}}
+	for _, key := range keys {
+		row := MatrixRow{App: key.app, Component: key.component}
+		var upstream []string
+		for _, env := range envs {
+			cell := MatrixCell{Versions: versions[key][env]}
+			sort.Strings(cell.Versions)
+			cell.Mixed = len(cell.Versions) > 1
+			if len(cell.Versions) > 0 {
+				if upstream == nil {
+					upstream = cell.Versions
+				} else {
+					cell.Lagging = !slices.Equal(cell.Versions, upstream)
+				}
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return res
+}
+
+func envRank(env string) int {
+	if index := slices.Index(envOrder, env); index != -1 {
+		return index
+	}
+	return len(envOrder)
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var crawlDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "ecsip_crawl_duration_seconds",
+	Help:    "Duration of crawling all clusters of the region.",
+	Buckets: []float64{1, 2, 5, 10, 20, 30, 60, 120, 300},
+}, []string{"region"})
+
+var (
+	snapshotAgeDesc = prometheus.NewDesc("ecsip_snapshot_age_seconds",
+		"Time since the cached inventory was crawled.", nil, nil)
+	serviceLabels           = []string{"account", "region", "cluster", "service", "app", "env"}
+	serviceRunningTasksDesc = prometheus.NewDesc("ecsip_service_running_tasks",
+		"Running tasks of the service.", serviceLabels, nil)
+	serviceDesiredTasksDesc = prometheus.NewDesc("ecsip_service_desired_tasks",
+		"Desired tasks of the service.", serviceLabels, nil)
+	servicePendingTasksDesc = prometheus.NewDesc("ecsip_service_pending_tasks",
+		"Pending tasks of the service.", serviceLabels, nil)
+	servicePublicIPsDesc = prometheus.NewDesc("ecsip_service_public_ips",
+		"Public IPv4 addresses of the service, auto-assigned and elastic.", serviceLabels, nil)
+	servicePrivateIPsDesc = prometheus.NewDesc("ecsip_service_private_ips",
+		"Private IPv4 addresses of the service.", serviceLabels, nil)
+)
+
+// inventoryCollector exports gauges of the cached inventory on every scrape, it never starts a crawl itself
+type inventoryCollector struct {
+	cache *snapshotCache
+}
+
+func (collector inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- snapshotAgeDesc
+	ch <- serviceRunningTasksDesc
+	ch <- serviceDesiredTasksDesc
+	ch <- servicePendingTasksDesc
+	ch <- servicePublicIPsDesc
+	ch <- servicePrivateIPsDesc
+}
+
+func (collector inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	snapshot := collector.cache.peek()
+	if snapshot == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(snapshotAgeDesc, prometheus.GaugeValue, time.Since(snapshot.FetchedAt).Seconds())
+	for _, cluster := range snapshot.Clusters {
+		for _, service := range cluster.Services {
+			labels := []string{cluster.Account, cluster.Region, cluster.Name, service.Name, service.App, service.Env}
+			ch <- prometheus.MustNewConstMetric(serviceRunningTasksDesc, prometheus.GaugeValue, float64(service.RunningCount), labels...)
+			ch <- prometheus.MustNewConstMetric(serviceDesiredTasksDesc, prometheus.GaugeValue, float64(service.DesiredCount), labels...)
+			ch <- prometheus.MustNewConstMetric(servicePendingTasksDesc, prometheus.GaugeValue, float64(service.PendingCount), labels...)
+			ch <- prometheus.MustNewConstMetric(servicePublicIPsDesc, prometheus.GaugeValue, float64(len(service.PublicIPs())), labels...)
+			ch <- prometheus.MustNewConstMetric(servicePrivateIPsDesc, prometheus.GaugeValue, float64(len(service.PrivateIPs())), labels...)
+		}
+	}
+}
+
+// registerMetrics adds Prometheus metrics of the crawler, the AWS API calls and the inventory.
+// Crawler and AWS API metrics are process wide in the default registry, the inventory collector gets
+// a registry of the server, so several servers can run in one process.
+func (server *FiberServer) registerMetrics() {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(inventoryCollector{cache: server.cache})
+	handler := promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, registry}, promhttp.HandlerOpts{})
+	server.Get("/metrics", adaptor.HTTPHandler(handler))
+}
@@ -0,0 +1,22 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetricsOfSeveralServers(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		server := NewServer(Config{Password: "secret", CacheTTL: time.Hour})
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.SetBasicAuth("admin", "secret")
+		res, err := server.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 200 {
+			t.Errorf("server %d: /metrics returned %d", i+1, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// VpcOption is a VPC found in the addresses of services and tasks, used to build filter options
+type VpcOption struct {
+	ID      string
+	Name    string
+	Subnets []SubnetOption
+}
+
+type SubnetOption struct {
+	ID               string
+	Name             string
+	CIDR             string
+	AvailabilityZone string
+}
+
+func (vpc VpcOption) Label() string {
+	return label(vpc.ID, vpc.Name)
+}
+
+func (subnet SubnetOption) Label() string {
+	return fmt.Sprintf("%s %s (%s)", label(subnet.ID, subnet.Name), subnet.CIDR, subnet.AvailabilityZone)
+}
+
+func label(id string, name string) string {
+	if name == "" {
+		return id
+	}
+	return fmt.Sprintf("%s %s", name, id)
+}
+
+func vpcOptions(clusters []aws.Cluster) []VpcOption {
+	res := []VpcOption{}
+	add := func(addresses []aws.Address) {
+		for _, address := range addresses {
+			if address.VpcID == "" {
+				continue
+			}
+			index := slices.IndexFunc(res, func(vpc VpcOption) bool { return vpc.ID == address.VpcID })
+			if index == -1 {
+				res = append(res, VpcOption{ID: address.VpcID, Name: address.VpcName})
+				index = len(res) - 1
+			}
+			// public addresses carry subnet of their network interface but not its CIDR
+			if address.SubnetID == "" || address.Public() {
+				continue
+			}
+			subnets := res[index].Subnets
+			subnetIndex := slices.IndexFunc(subnets, func(subnet SubnetOption) bool { return subnet.ID == address.SubnetID })
+			if subnetIndex == -1 {
+				subnets = append(subnets, SubnetOption{ID: address.SubnetID, Name: address.SubnetName, AvailabilityZone: address.AvailabilityZone})
+				subnetIndex = len(subnets) - 1
+			}
+			// IPv6 addresses carry IPv6 CIDR of the subnet, IPv4 one is shown
+			if address.Kind == aws.AddressPrivate && address.SubnetCIDR.IsValid() {
+				subnets[subnetIndex].CIDR = address.SubnetCIDR.String()
+			}
+			res[index].Subnets = subnets
+		}
+	}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			add(service.Addresses)
+		}
+		for _, group := range cluster.TaskGroups {
+			for _, task := range group.Tasks {
+				add(task.Addresses)
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Label() < res[j].Label() })
+	for _, vpc := range res {
+		sort.Slice(vpc.Subnets, func(i, j int) bool { return vpc.Subnets[i].Label() < vpc.Subnets[j].Label() })
+	}
+	return res
+}
+
+// networks returns unique VPC and subnet names of the addresses
+func networks(addresses []aws.Address) []string {
+	res := []string{}
+	for _, address := range addresses {
+		if address.VpcID == "" || address.Public() {
+			continue
+		}
+		network := fmt.Sprintf("%s / %s", label(address.VpcID, address.VpcName), label(address.SubnetID, address.SubnetName))
+		if address.AvailabilityZone != "" {
+			network = fmt.Sprintf("%s (%s)", network, address.AvailabilityZone)
+		}
+		if !slices.Contains(res, network) {
+			res = append(res, network)
+		}
+	}
+	return res
+}
@@ -5,6 +5,7 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/a-h/templ"
 	"github.com/gofiber/fiber/v2"
@@ -14,38 +15,116 @@ import (
 
 type FiberServer struct {
 	*fiber.App
+	cache  *snapshotCache
+	config Config
 }
 
-func NewServer(region string, password string) *FiberServer {
+// Config is the server configuration read from env
+type Config struct {
+	// Region is a comma separated list of regions to crawl
+	Region   string
+	Password string
+	// CacheTTL is the interval of the background refresh
+	CacheTTL  time.Duration
+	Discovery DiscoveryConfig
+	Exports   ExportConfig
+	DNS       DNSConfig
+}
+
+func NewServer(config Config) *FiberServer {
 	server := &FiberServer{
 		App: fiber.New(fiber.Config{
 			ServerHeader: "ecs-ip",
 			AppName:      "ecs-ip",
 		}),
+		cache: &snapshotCache{
+			ttl:     config.CacheTTL,
+			regions: strings.Split(config.Region, ","),
+		},
+		config: config,
 	}
 
 	// use basic auth with only one user and password from env
 	server.Use(basicauth.New(basicauth.Config{
 		Users: map[string]string{
-			"admin": password,
+			"admin": config.Password,
 		},
 	}))
 
 	server.Get("/", func(c *fiber.Ctx) error {
-		regions := strings.Split(region, ",")
-		clusters := []aws.Cluster{}
-		for _, r := range regions {
-			clusters = append(clusters, aws.NewStore(r).Clusters()...)
+		clusters := server.clusters()
+		filter := filterFromQuery(c)
+		if format := c.Query("format"); format != "" {
+			return exportTable(c, Filtered(clusters, filter), format)
 		}
 
-		selectedApp := c.Query("app")
+		return Render(c, HomePage(Filtered(clusters, filter), filterOptions(clusters), filter))
+	})
+
+	server.Get("/matrix", func(c *fiber.Ctx) error {
+		return Render(c, MatrixPage(versionMatrix(server.clusters())))
+	})
 
-		return Render(c, HomePage(filteredByApp(clusters, selectedApp), appSlugs(clusters), selectedApp))
+	server.Get("/lookup", func(c *fiber.Ctx) error {
+		query := c.Query("ip")
+		if query == "" {
+			return Render(c, LookupPage(query, nil, nil))
+		}
+		owners, err := server.cache.addressIndex().Lookup(query)
+		return Render(c, LookupPage(query, owners, err))
 	})
 
+	server.Get("/api/lookup", func(c *fiber.Ctx) error {
+		owners, err := server.cache.addressIndex().Lookup(c.Query("ip"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return c.JSON(owners)
+	})
+
+	server.Get("/analysis", func(c *fiber.Ctx) error {
+		return Render(c, AnalysisPage(analyze(server.clusters())))
+	})
+
+	server.Get("/api/analysis", func(c *fiber.Ctx) error {
+		return c.JSON(analyze(server.clusters()))
+	})
+
+	server.Get("/compare", func(c *fiber.Ctx) error {
+		clusters := server.clusters()
+		comparison := compare(clusters, c.Query("app"), c.Query("left"), c.Query("right"))
+
+		return Render(c, ComparePage(comparison, appSlugs(clusters), envSlugs(clusters)))
+	})
+
+	server.Get("/api/compare", func(c *fiber.Ctx) error {
+		if c.Query("app") == "" || c.Query("left") == "" || c.Query("right") == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "app, left and right query parameters are required")
+		}
+		return c.JSON(compare(server.clusters(), c.Query("app"), c.Query("left"), c.Query("right")))
+	})
+
+	server.registerServicePage()
+	server.registerAPI()
+	server.registerGraphQL()
+	server.registerEvents()
+	server.registerDiscovery()
+	server.registerMetrics()
+	server.registerAnsible()
+	server.registerExports()
+	server.registerAllowlist()
+	server.registerTemplates()
+
+	go server.cache.refresh()
+
 	return server
 }
 
+// clusters returns clusters of all configured regions from the cached snapshot
+func (server *FiberServer) clusters() []aws.Cluster {
+	return server.cache.get().Clusters
+}
+
 func appSlugs(clusters []aws.Cluster) []string {
 	res := []string{}
 	for _, cluster := range clusters {
@@ -61,23 +140,18 @@ func appSlugs(clusters []aws.Cluster) []string {
 	return res
 }
 
-func filteredByApp(clusters []aws.Cluster, app string) []aws.Cluster {
-	if app == "" {
-		return clusters
-	}
-	res := []aws.Cluster{}
+func envSlugs(clusters []aws.Cluster) []string {
+	res := []string{}
 	for _, cluster := range clusters {
-		services := []aws.Service{}
 		for _, service := range cluster.Services {
-			if service.App == app {
-				services = append(services, service)
+			if service.Env != "" {
+				if !slices.Contains(res, service.Env) {
+					res = append(res, service.Env)
+				}
 			}
 		}
-		if len(services) > 0 {
-			cluster.Services = services
-			res = append(res, cluster)
-		}
 	}
+	sort.Strings(res)
 	return res
 }
 
@@ -0,0 +1,219 @@
+package web
+
+import (
+	"context"
+	"ecs-ip/internal/aws"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/gofiber/fiber/v2"
+)
+
+// assets are Bootstrap files of the version the pages load from CDN, the static site must work without internet
+//
+//go:embed assets
+var assets embed.FS
+
+type siteKey struct{}
+
+// staticSite is set in the context of pages rendered by RenderSite,
+// depth is the number of directories between the page and the site root
+type staticSite struct {
+	depth int
+}
+
+// isStatic reports whether the page is rendered for the static site, where parts needing the server are hidden
+func isStatic(ctx context.Context) bool {
+	_, ok := ctx.Value(siteKey{}).(staticSite)
+	return ok
+}
+
+// siteURL returns the server URL as is, or the relative link of the file for the static site,
+// links without a file, e.g. filters other than a single app, are dead there and templates should not render them
+func siteURL(ctx context.Context, url string) string {
+	site, ok := ctx.Value(siteKey{}).(staticSite)
+	if !ok {
+		return url
+	}
+	file, ok := sitePath(url)
+	if !ok {
+		return "#"
+	}
+	return strings.Repeat("../", site.depth) + file
+}
+
+var invalidFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// sitePath maps a server URL to the file of the static site, it reports false for URLs of pages which need the server
+func sitePath(link string) (string, bool) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	query := parsed.Query()
+	// services of the same name in clusters of the same name live in other regions or accounts
+	if (strings.HasPrefix(parsed.Path, "/services/") || strings.HasPrefix(parsed.Path, "/api/v1/services/")) && len(segments) >= 3 {
+		prefix := len(segments) - 3
+		segments = slices.Concat(segments[:prefix+1], []string{query.Get("account"), query.Get("region")}, segments[prefix+1:])
+		query.Del("account")
+		query.Del("region")
+	}
+	for i, segment := range segments {
+		segment, _ = url.PathUnescape(segment)
+		segments[i] = invalidFileChars.ReplaceAllString(segment, "-")
+	}
+	switch {
+	case parsed.Path == "/" && len(query) == 0:
+		return "index.html", true
+	case parsed.Path == "/" && len(query) == 1 && query.Get("app") != "":
+		return "apps/" + invalidFileChars.ReplaceAllString(query.Get("app"), "-") + ".html", true
+	case len(query) > 0:
+		return "", false
+	case parsed.Path == "/matrix", parsed.Path == "/analysis":
+		return segments[0] + ".html", true
+	case strings.HasPrefix(parsed.Path, "/services/"):
+		return path.Join(segments...) + ".html", true
+	case strings.HasPrefix(parsed.Path, "/api/v1/"):
+		return path.Join(segments...) + ".json", true
+	case strings.HasPrefix(parsed.Path, "/assets/"):
+		return path.Join(segments...), true
+	default:
+		return "", false
+	}
+}
+
+// serviceURL has region and account in the query, names of clusters and services are unique only within them
+func serviceURL(cluster aws.Cluster, service aws.Service) string {
+	query := url.Values{"region": {cluster.Region}, "account": {cluster.Account}}
+	return "/services/" + url.PathEscape(cluster.Name) + "/" + url.PathEscape(service.Name) + "?" + query.Encode()
+}
+
+// matchServiceParams checks cluster and service names of the path, region and account are checked when they are in the query
+func matchServiceParams(c *fiber.Ctx, cluster string, region string, account string, service string) bool {
+	return cluster == c.Params("cluster") && service == c.Params("name") &&
+		(c.Query("region") == "" || region == c.Query("region")) &&
+		(c.Query("account") == "" || account == c.Query("account"))
+}
+
+func (server *FiberServer) registerServicePage() {
+	server.Get("/services/:cluster/:name", func(c *fiber.Ctx) error {
+		for _, cluster := range server.clusters() {
+			for _, service := range cluster.Services {
+				if matchServiceParams(c, cluster.Name, cluster.Region, cluster.Account, service.Name) {
+					return Render(c, ServicePage(cluster, service))
+				}
+			}
+		}
+		return fiber.NewError(fiber.StatusNotFound, "service not found")
+	})
+}
+
+// RenderSite writes a read-only snapshot of the inventory which any static server can serve:
+// the home page, a page per app, version matrix, analysis, a page per service and JSON files of the API
+func RenderSite(clusters []aws.Cluster, dir string) error {
+	options := filterOptions(clusters)
+	pages := map[string]templ.Component{
+		"/":         HomePage(clusters, options, Filter{}),
+		"/matrix":   MatrixPage(versionMatrix(clusters)),
+		"/analysis": AnalysisPage(analyze(clusters)),
+	}
+	for _, app := range options.Apps {
+		filter := Filter{App: app}
+		pages[filter.Query("app", app)] = HomePage(Filtered(clusters, filter), options, filter)
+	}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			pages[serviceURL(cluster, service)] = ServicePage(cluster, service)
+		}
+	}
+	files := map[string]string{}
+	// file names replace characters which are not safe in paths, so different links may still meet
+	siteFile := func(link string) (string, error) {
+		name, ok := sitePath(link)
+		if !ok {
+			return "", fmt.Errorf("no static file for %s", link)
+		}
+		if other, ok := files[name]; ok {
+			return "", fmt.Errorf("%s and %s are both written to %s", other, link, name)
+		}
+		files[name] = link
+		return name, nil
+	}
+	for link, component := range pages {
+		file, err := siteFile(link)
+		if err != nil {
+			return err
+		}
+		ctx := context.WithValue(context.Background(), siteKey{}, staticSite{depth: strings.Count(file, "/")})
+		if err := writeSiteFile(dir, file, func(w *os.File) error { return component.Render(ctx, w) }); err != nil {
+			return err
+		}
+	}
+
+	// JSON files are the API responses with all items on one page
+	items := serviceItems(clusters)
+	owners := newAddressIndex(clusters).owners
+	documents := map[string]any{
+		"/api/v1/clusters": page(clusterItems(clusters), len(clusters), 0),
+		"/api/v1/services": page(items, len(items), 0),
+		"/api/v1/ips":      page(owners, len(owners), 0),
+	}
+	for _, item := range items {
+		documents["/api/v1"+serviceURL(aws.Cluster{Name: item.Cluster, Region: item.Region, Account: item.Account}, item.Service)] = item
+	}
+	for link, document := range documents {
+		file, err := siteFile(link)
+		if err != nil {
+			return err
+		}
+		err = writeSiteFile(dir, file, func(w *os.File) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(document)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return fs.WalkDir(assets, "assets", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := assets.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return writeSiteFile(dir, name, func(w *os.File) error {
+			_, err := w.Write(content)
+			return err
+		})
+	})
+}
+
+func writeSiteFile(dir string, name string, write func(*os.File) error) error {
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	w, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := write(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
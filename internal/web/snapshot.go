@@ -0,0 +1,187 @@
+package web
+
+import (
+	"crypto/sha256"
+	"ecs-ip/internal/aws"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Snapshot is the crawled inventory which is shared between requests until the background refresh replaces it
+type Snapshot struct {
+	Clusters  []aws.Cluster
+	FetchedAt time.Time
+	// ETag is a hash of the inventory, it changes only when the inventory changes
+	ETag string
+}
+
+type snapshotCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	regions  []string
+	snapshot *Snapshot
+	// subscribers get changes found by the background refresh
+	subscribers map[chan []Change]struct{}
+
+	// index is the address index of a snapshot, lookups share it until the refresh swaps the snapshot
+	indexMu sync.Mutex
+	index   *snapshotIndex
+}
+
+type snapshotIndex struct {
+	snapshot *Snapshot
+	index    *AddressIndex
+}
+
+// get returns cached snapshot, the first call crawls all regions
+func (cache *snapshotCache) get() *Snapshot {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.snapshot == nil {
+		cache.snapshot = newSnapshot(Crawl(cache.regions))
+	}
+	return cache.snapshot
+}
+
+// peek returns cached snapshot without crawling, it is nil before the first crawl
+func (cache *snapshotCache) peek() *Snapshot {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.snapshot
+}
+
+// addressIndex returns the address index of the cached snapshot, it is built once per snapshot
+func (cache *snapshotCache) addressIndex() *AddressIndex {
+	snapshot := cache.get()
+	cache.indexMu.Lock()
+	defer cache.indexMu.Unlock()
+	if cache.index == nil || cache.index.snapshot != snapshot {
+		cache.index = &snapshotIndex{snapshot: snapshot, index: newAddressIndex(snapshot.Clusters)}
+	}
+	return cache.index.index
+}
+
+// refresh crawls all regions every TTL and notifies subscribers about the differences
+func (cache *snapshotCache) refresh() {
+	// time.Tick returns nil for such TTL and the loop would block forever
+	if cache.ttl <= 0 {
+		log.Printf("cache TTL is %s, the inventory is not refreshed in background", cache.ttl)
+		return
+	}
+	for range time.Tick(cache.ttl) {
+		snapshot := newSnapshot(Crawl(cache.regions))
+
+		cache.mu.Lock()
+		previous := cache.snapshot
+		cache.snapshot = snapshot
+		cache.mu.Unlock()
+
+		if previous == nil || previous.ETag == snapshot.ETag {
+			continue
+		}
+		if changes := diff(previous.Clusters, snapshot.Clusters); len(changes) > 0 {
+			cache.publish(changes)
+		}
+	}
+}
+
+// subscribe returns a channel of changes and a function which must be called when the subscriber is gone
+func (cache *snapshotCache) subscribe() (chan []Change, func()) {
+	ch := make(chan []Change, 16)
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.subscribers == nil {
+		cache.subscribers = map[chan []Change]struct{}{}
+	}
+	cache.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		delete(cache.subscribers, ch)
+	}
+}
+
+func (cache *snapshotCache) publish(changes []Change) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for ch := range cache.subscribers {
+		// do not let a slow subscriber block the refresh, it misses changes and catches up on reload
+		select {
+		case ch <- changes:
+		default:
+			log.Printf("subscriber is too slow, %d changes are dropped", len(changes))
+		}
+	}
+}
+
+// Crawl fetches clusters from all regions
+func Crawl(regions []string) []aws.Cluster {
+	clusters := []aws.Cluster{}
+	for _, r := range regions {
+		start := time.Now()
+		clusters = append(clusters, aws.NewStore(r).Clusters()...)
+		crawlDuration.WithLabelValues(r).Observe(time.Since(start).Seconds())
+	}
+	sortClusters(clusters)
+	return clusters
+}
+
+// sortClusters orders everything the store fetches concurrently, so the ETag changes only when the inventory changes
+// and API pages keep their items between refreshes
+func sortClusters(clusters []aws.Cluster) {
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if clusters[i].Region != clusters[j].Region {
+			return clusters[i].Region < clusters[j].Region
+		}
+		if clusters[i].Account != clusters[j].Account {
+			return clusters[i].Account < clusters[j].Account
+		}
+		return clusters[i].Name < clusters[j].Name
+	})
+	sortTasks := func(tasks []aws.Task) {
+		sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Arn < tasks[j].Arn })
+	}
+	sortAddresses := func(addresses []aws.Address) {
+		sort.SliceStable(addresses, func(i, j int) bool { return addresses[i].IP.Less(addresses[j].IP) })
+	}
+	for _, cluster := range clusters {
+		sort.SliceStable(cluster.Services, func(i, j int) bool { return cluster.Services[i].Name < cluster.Services[j].Name })
+		for _, service := range cluster.Services {
+			sortTasks(service.Tasks)
+			sortAddresses(service.Addresses)
+		}
+		sort.SliceStable(cluster.TaskGroups, func(i, j int) bool {
+			if cluster.TaskGroups[i].Group != cluster.TaskGroups[j].Group {
+				return cluster.TaskGroups[i].Group < cluster.TaskGroups[j].Group
+			}
+			return cluster.TaskGroups[i].StartedBy < cluster.TaskGroups[j].StartedBy
+		})
+		for _, group := range cluster.TaskGroups {
+			sortTasks(group.Tasks)
+		}
+		sort.SliceStable(cluster.Hosts, func(i, j int) bool { return cluster.Hosts[i].ID < cluster.Hosts[j].ID })
+		sort.SliceStable(cluster.Vpcs, func(i, j int) bool { return cluster.Vpcs[i].ID < cluster.Vpcs[j].ID })
+	}
+}
+
+func newSnapshot(clusters []aws.Cluster) *Snapshot {
+	res := &Snapshot{
+		Clusters:  clusters,
+		FetchedAt: time.Now(),
+	}
+	data, err := json.Marshal(clusters)
+	if err != nil {
+		log.Printf("cannot compute snapshot ETag: %v", err)
+		return res
+	}
+	hash := sha256.Sum256(data)
+	res.ETag = hex.EncodeToString(hash[:16])
+	return res
+}
@@ -0,0 +1,254 @@
+package web
+
+import (
+	"archive/zip"
+	"bytes"
+	"ecs-ip/internal/aws"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/samber/lo"
+)
+
+// Table is the service table of the home page as plain text cells, multiple values are joined by comma
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// exportTable sends the table of the home page as a file, rows are services or, with rows=task, tasks
+func exportTable(c *fiber.Ctx, clusters []aws.Cluster, format string) error {
+	table := serviceTable(clusters)
+	if c.Query("rows") == "task" {
+		table = taskTable(clusters)
+	}
+	name := fmt.Sprintf("ecs-ip-%s", time.Now().UTC().Format("20060102-150405"))
+
+	switch format {
+	case "csv":
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Attachment(name + ".csv")
+		return table.writeCSV(c)
+	case "md":
+		c.Set(fiber.HeaderContentType, "text/markdown; charset=utf-8")
+		c.Attachment(name + ".md")
+		return c.SendString(table.markdown())
+	case "xlsx":
+		res, err := table.xlsx()
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Attachment(name + ".xlsx")
+		return c.Send(res)
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "format must be one of csv, xlsx, md")
+	}
+}
+
+// exportURL returns the link of a download button, it keeps the filters of the page
+func exportURL(filter Filter, format string, rows string) string {
+	values := url.Values{}
+	for key, value := range filter.values() {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	values.Set("format", format)
+	if rows != "" {
+		values.Set("rows", rows)
+	}
+	return "/?" + values.Encode()
+}
+
+// serviceTable has the columns of the service table of the home page
+func serviceTable(clusters []aws.Cluster) Table {
+	res := Table{Header: []string{
+		"Cluster", "App", "Env", "Component", "Container", "Public IP", "Private IP", "IPv6", "Network", "Hosts",
+		"Tasks", "Rollout", "Version", "Image", "Launch type", "Capacity providers", "Platform", "Spot",
+	}}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			res.Rows = append(res.Rows, []string{
+				cluster.Name,
+				service.App,
+				service.Env,
+				service.Component,
+				service.Container,
+				strings.Join(service.PublicIPs(), ", "),
+				strings.Join(service.PrivateIPs(), ", "),
+				strings.Join(service.IPv6s(), ", "),
+				strings.Join(networks(service.Addresses), ", "),
+				strings.Join(lo.Map(service.Hosts(), func(host aws.Host, _ int) string { return hostLabel(host) }), ", "),
+				fmt.Sprintf("%d/%d", service.RunningCount, service.DesiredCount),
+				service.RolloutState,
+				service.Version,
+				service.Image,
+				launchTypes(service),
+				capacityProviders(service),
+				service.PlatformVersion,
+				spotLabel(service.Spot(), fmt.Sprintf("%d/%d", service.SpotTasks(), len(service.Tasks))),
+			})
+		}
+	}
+	return res
+}
+
+// taskTable has a row per task of services and per standalone task
+func taskTable(clusters []aws.Cluster) Table {
+	res := Table{Header: []string{
+		"Cluster", "App", "Env", "Component", "Service", "Group", "Task", "Public IP", "Private IP", "IPv6", "Network",
+		"Host", "Version", "Launch type", "Capacity provider", "Platform", "Spot",
+	}}
+	row := func(cluster aws.Cluster, service aws.Service, task aws.Task) []string {
+		host := ""
+		if task.Host != nil {
+			host = hostLabel(*task.Host)
+		}
+		return []string{
+			cluster.Name,
+			service.App,
+			service.Env,
+			service.Component,
+			service.Name,
+			task.Group,
+			task.Arn[strings.LastIndex(task.Arn, "/")+1:],
+			strings.Join(task.PublicIPs(), ", "),
+			strings.Join(task.PrivateIPs(), ", "),
+			strings.Join(task.IPv6s(), ", "),
+			strings.Join(networks(task.Addresses), ", "),
+			host,
+			service.Version,
+			task.LaunchType,
+			task.CapacityProvider,
+			task.PlatformVersion,
+			spotLabel(task.Spot, ""),
+		}
+	}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			for _, task := range service.Tasks {
+				res.Rows = append(res.Rows, row(cluster, service, task))
+			}
+		}
+		for _, group := range cluster.TaskGroups {
+			for _, task := range group.Tasks {
+				res.Rows = append(res.Rows, row(cluster, aws.Service{}, task))
+			}
+		}
+	}
+	return res
+}
+
+// hostLabel is the host name as the home page shows it
+func hostLabel(host aws.Host) string {
+	res := host.ID
+	if host.Hostname != "" {
+		res = host.Hostname
+	}
+	if host.External {
+		res += " (external)"
+	}
+	return res
+}
+
+func spotLabel(spot bool, detail string) string {
+	if !spot {
+		return ""
+	}
+	return strings.TrimSpace("spot " + detail)
+}
+
+func (table Table) writeCSV(c *fiber.Ctx) error {
+	w := csv.NewWriter(c)
+	if err := w.Write(table.Header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(table.Rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+func (table Table) markdown() string {
+	var res strings.Builder
+	line := func(cells []string) {
+		res.WriteString("|")
+		for _, cell := range cells {
+			// pipes end the cell and new lines end the row, so both are escaped
+			cell = strings.ReplaceAll(cell, "|", `\|`)
+			cell = strings.ReplaceAll(cell, "\n", "<br>")
+			res.WriteString(" " + cell + " |")
+		}
+		res.WriteString("\n")
+	}
+	line(table.Header)
+	line(lo.Map(table.Header, func(_ string, _ int) string { return "---" }))
+	for _, row := range table.Rows {
+		line(row)
+	}
+	return res.String()
+}
+
+// xlsx writes the minimal Office Open XML workbook with one sheet and inline strings, which Excel, LibreOffice
+// and Google Sheets open, a spreadsheet library would be a large dependency for one table
+func (table Table) xlsx() ([]byte, error) {
+	var sheet bytes.Buffer
+	sheet.WriteString(xml.Header)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for _, row := range append([][]string{table.Header}, table.Rows...) {
+		sheet.WriteString("<row>")
+		for _, cell := range row {
+			sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(&sheet, []byte(cell)); err != nil {
+				return nil, err
+			}
+			sheet.WriteString("</t></is></c>")
+		}
+		sheet.WriteString("</row>")
+	}
+	sheet.WriteString("</sheetData></worksheet>")
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="ecs-ip" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	}
+
+	var res bytes.Buffer
+	archive := zip.NewWriter(&res)
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(file.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
@@ -0,0 +1,205 @@
+package web
+
+import (
+	"ecs-ip/internal/aws"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// templateExtension is the extension of files in the templates directory, haproxy.cfg.tmpl is served at /export/t/haproxy.cfg
+const templateExtension = ".tmpl"
+
+// TemplateData is the data of user-defined templates
+type TemplateData struct {
+	// Clusters are clusters matching the filters from the query
+	Clusters []aws.Cluster
+	// Services are services of all clusters, sorted by cluster and name
+	Services []TemplateService
+	// Query holds all query parameters, so templates may take their own ones
+	Query       map[string]string
+	GeneratedAt time.Time
+}
+
+// TemplateService is a service with its cluster, service fields are available directly, e.g. {{.App}}
+type TemplateService struct {
+	aws.Service
+	Cluster string
+	Region  string
+	Account string
+}
+
+// TemplateGroup is an item of groupBy result
+type TemplateGroup struct {
+	Key      string
+	Services []TemplateService
+}
+
+func (server *FiberServer) registerTemplates() {
+	server.Get("/export/t/:name", func(c *fiber.Ctx) error {
+		dir := server.config.Exports.TemplatesDir
+		name := c.Params("name")
+		if dir == "" {
+			return fiber.NewError(fiber.StatusNotFound, "templates directory is not set")
+		}
+		// names are file names, they must not point outside of the directory
+		if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid template name")
+		}
+		// templates are read on every request, so new and edited files are served without restart
+		text, err := os.ReadFile(filepath.Join(dir, name+templateExtension))
+		if os.IsNotExist(err) {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("template %s is not found", name))
+		}
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New(name).Funcs(templateFuncs).Parse(string(text))
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+
+		clusters := Filtered(server.clusters(), filterFromQuery(c))
+		data := TemplateData{
+			Clusters:    clusters,
+			Services:    templateServices(clusters),
+			Query:       c.Queries(),
+			GeneratedAt: time.Now().UTC(),
+		}
+		var res strings.Builder
+		if err := tmpl.Execute(&res, data); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+		return c.SendString(res.String())
+	})
+}
+
+func templateServices(clusters []aws.Cluster) []TemplateService {
+	res := []TemplateService{}
+	for _, cluster := range clusters {
+		for _, service := range cluster.Services {
+			res = append(res, TemplateService{Service: service, Cluster: cluster.Name, Region: cluster.Region, Account: cluster.Account})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Cluster != res[j].Cluster {
+			return res[i].Cluster < res[j].Cluster
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// templateFuncs are helpers for user-defined templates, list helpers take the list last so they can be piped:
+// {{range .Services | where "Env" "prod" | groupBy "App"}}
+var templateFuncs = template.FuncMap{
+	// where keeps services with the field equal to one of the values
+	"where": func(field string, args ...any) ([]TemplateService, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("where needs a field, values and a list of services")
+		}
+		services, ok := args[len(args)-1].([]TemplateService)
+		if !ok {
+			return nil, fmt.Errorf("where needs a list of services, got %T", args[len(args)-1])
+		}
+		res := []TemplateService{}
+		for _, service := range services {
+			value, err := serviceField(service, field)
+			if err != nil {
+				return nil, err
+			}
+			for _, arg := range args[:len(args)-1] {
+				if fmt.Sprint(arg) == value {
+					res = append(res, service)
+					break
+				}
+			}
+		}
+		return res, nil
+	},
+	// groupBy groups services by the field, groups are sorted by the key
+	"groupBy": func(field string, services []TemplateService) ([]TemplateGroup, error) {
+		res := []TemplateGroup{}
+		index := map[string]int{}
+		for _, service := range services {
+			key, err := serviceField(service, field)
+			if err != nil {
+				return nil, err
+			}
+			if i, ok := index[key]; ok {
+				res[i].Services = append(res[i].Services, service)
+				continue
+			}
+			index[key] = len(res)
+			res = append(res, TemplateGroup{Key: key, Services: []TemplateService{service}})
+		}
+		sort.SliceStable(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+		return res, nil
+	},
+	"sortBy": func(field string, services []TemplateService) ([]TemplateService, error) {
+		res := append([]TemplateService{}, services...)
+		for _, service := range res {
+			if _, err := serviceField(service, field); err != nil {
+				return nil, err
+			}
+		}
+		sort.SliceStable(res, func(i, j int) bool {
+			left, _ := serviceField(res[i], field)
+			right, _ := serviceField(res[j], field)
+			return left < right
+		})
+		return res, nil
+	},
+	// targets returns ip:port of tasks of the service for the container port, ports are host ports for bridge network mode
+	"targets": func(containerPort int, service TemplateService) []string {
+		res := []string{}
+		container := ""
+		for _, definition := range service.TaskDefinition.Containers {
+			for _, mapping := range definition.PortMappings {
+				if mapping.ContainerPort == int32(containerPort) && container == "" {
+					container = definition.Name
+				}
+			}
+		}
+		for _, task := range service.Tasks {
+			if address, ok := taskTargetAddress(task); ok {
+				res = append(res, fmt.Sprintf("%s:%d", address.IP, task.HostPort(container, int32(containerPort))))
+			}
+		}
+		sort.Strings(res)
+		return res
+	},
+	"hostName":  hostName,
+	"join":      func(separator string, values []string) string { return strings.Join(values, separator) },
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"replace":   func(old string, new string, value string) string { return strings.ReplaceAll(value, old, new) },
+	"hasPrefix": func(prefix string, value string) bool { return strings.HasPrefix(value, prefix) },
+	"default": func(fallback any, value any) any {
+		if value == nil || reflect.ValueOf(value).IsZero() {
+			return fallback
+		}
+		return value
+	},
+	"toJSON": func(value any) (string, error) {
+		res, err := json.Marshal(value)
+		return string(res), err
+	},
+}
+
+// serviceField returns a string field of the service or of its cluster by name, e.g. App or Cluster
+func serviceField(service TemplateService, field string) (string, error) {
+	value := reflect.ValueOf(service).FieldByName(field)
+	if !value.IsValid() || value.Kind() != reflect.String {
+		return "", fmt.Errorf("%s is not a string field of a service", field)
+	}
+	return value.String(), nil
+}
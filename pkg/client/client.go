@@ -0,0 +1,195 @@
+// Package client queries the JSON API of an ecs-ip server.
+//
+//	c := client.New("https://ecs-ip.example.com", os.Getenv("ECS_IP_PASSWORD"))
+//	services, err := c.Services(ctx, client.Filter{App: "wl-widgets", Env: "prod"}, client.PageOptions{})
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client is safe for concurrent use
+type Client struct {
+	baseURL    string
+	password   string
+	httpClient *http.Client
+}
+
+// New returns a client of the server at baseURL, password is ADMIN_PASSWORD of the server
+func New(baseURL string, password string) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		password:   password,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// WithHTTPClient returns a copy of the client which sends requests with httpClient
+func (client *Client) WithHTTPClient(httpClient *http.Client) *Client {
+	res := *client
+	res.httpClient = httpClient
+	return &res
+}
+
+// Filter has the same fields as the filters of the UI, empty fields are not applied
+type Filter struct {
+	App     string
+	Env     string
+	Cluster string
+	Region  string
+	Account string
+	// LaunchType is EC2, FARGATE or EXTERNAL
+	LaunchType string
+	// Spot is "yes" to return only workloads which can be interrupted and "no" to exclude them
+	Spot string
+	// IPVersion is "4" or "6"
+	IPVersion string
+	Vpc       string
+	Subnet    string
+	// Search is free text, an IP address or a CIDR
+	Search string
+}
+
+func (filter Filter) values() url.Values {
+	res := url.Values{}
+	for key, value := range map[string]string{
+		"app":        filter.App,
+		"env":        filter.Env,
+		"cluster":    filter.Cluster,
+		"region":     filter.Region,
+		"account":    filter.Account,
+		"launchType": filter.LaunchType,
+		"spot":       filter.Spot,
+		"ipVersion":  filter.IPVersion,
+		"vpc":        filter.Vpc,
+		"subnet":     filter.Subnet,
+		"q":          filter.Search,
+	} {
+		if value != "" {
+			res.Set(key, value)
+		}
+	}
+	return res
+}
+
+// PageOptions select a page of a list, zero Limit means the server default
+type PageOptions struct {
+	Limit  int
+	Offset int
+}
+
+func (options PageOptions) apply(values url.Values) url.Values {
+	if options.Limit > 0 {
+		values.Set("limit", strconv.Itoa(options.Limit))
+	}
+	if options.Offset > 0 {
+		values.Set("offset", strconv.Itoa(options.Offset))
+	}
+	return values
+}
+
+// Error is returned when the server responds with a status other than 200
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("ecs-ip: %d %s", err.StatusCode, err.Message)
+}
+
+func (client *Client) Clusters(ctx context.Context, filter Filter, options PageOptions) (Page[Cluster], error) {
+	res := Page[Cluster]{}
+	err := client.get(ctx, "/api/v1/clusters", options.apply(filter.values()), &res)
+	return res, err
+}
+
+func (client *Client) Services(ctx context.Context, filter Filter, options PageOptions) (Page[Service], error) {
+	res := Page[Service]{}
+	err := client.get(ctx, "/api/v1/services", options.apply(filter.values()), &res)
+	return res, err
+}
+
+// ServiceOptions pick the service when clusters of the same name exist in several regions or accounts,
+// empty fields return the first service found
+type ServiceOptions struct {
+	Region  string
+	Account string
+}
+
+// Service returns the service by cluster name and service name, the error is *Error with 404 status when it is not found
+func (client *Client) Service(ctx context.Context, cluster string, name string, options ServiceOptions) (Service, error) {
+	res := Service{}
+	query := url.Values{}
+	if options.Region != "" {
+		query.Set("region", options.Region)
+	}
+	if options.Account != "" {
+		query.Set("account", options.Account)
+	}
+	err := client.get(ctx, "/api/v1/services/"+url.PathEscape(cluster)+"/"+url.PathEscape(name), query, &res)
+	return res, err
+}
+
+// IPs returns addresses of the filtered inventory with their owners
+func (client *Client) IPs(ctx context.Context, filter Filter, options PageOptions) (Page[Owner], error) {
+	res := Page[Owner]{}
+	err := client.get(ctx, "/api/v1/ips", options.apply(filter.values()), &res)
+	return res, err
+}
+
+// Lookup returns owners of the IP address or of all addresses inside the CIDR
+func (client *Client) Lookup(ctx context.Context, query string) ([]Owner, error) {
+	res := []Owner{}
+	err := client.get(ctx, "/api/lookup", url.Values{"ip": {query}}, &res)
+	return res, err
+}
+
+// AllServices fetches all pages of services
+func (client *Client) AllServices(ctx context.Context, filter Filter) ([]Service, error) {
+	res := []Service{}
+	options := PageOptions{Limit: 1000}
+	for {
+		page, err := client.Services(ctx, filter, options)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, page.Items...)
+		options.Offset += len(page.Items)
+		if len(page.Items) == 0 || options.Offset >= page.Total {
+			return res, nil
+		}
+	}
+}
+
+func (client *Client) get(ctx context.Context, path string, query url.Values, body any) error {
+	endpoint := client.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("admin", client.password)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return json.NewDecoder(resp.Body).Decode(body)
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newTestServer is a stand-in of the ecs-ip API with 5 services, it records queries of the requests
+func newTestServer(t *testing.T, queries *[]string) *Client {
+	services := []Service{}
+	for i := 1; i <= 5; i++ {
+		services = append(services, Service{Cluster: "main", Region: "eu-west-1", Name: fmt.Sprintf("web-%d", i)})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*queries = append(*queries, r.URL.RawQuery)
+		if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/api/v1/services":
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			items := services[min(offset, len(services)):min(offset+limit, len(services))]
+			json.NewEncoder(w).Encode(Page[Service]{Items: items, Total: len(services), Limit: limit, Offset: offset})
+		case "/api/v1/services/main%20cluster/web-1":
+			if r.URL.Query().Get("region") != "us-east-1" {
+				http.Error(w, "service not found", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(services[0])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return New(server.URL+"/", "secret").WithHTTPClient(server.Client())
+}
+
+func TestClientQuery(t *testing.T) {
+	var queries []string
+	client := newTestServer(t, &queries)
+
+	_, err := client.Services(context.Background(), Filter{App: "widgets", IPVersion: "6", Search: "10.0.0.0/16"}, PageOptions{Limit: 2, Offset: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "app=widgets&ipVersion=6&limit=2&offset=4&q=10.0.0.0%2F16"; queries[0] != want {
+		t.Errorf("query %q, want %q", queries[0], want)
+	}
+
+	service, err := client.Service(context.Background(), "main cluster", "web-1", ServiceOptions{Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.Name != "web-1" || queries[1] != "region=us-east-1" {
+		t.Errorf("service %q with query %q, want web-1 with region=us-east-1", service.Name, queries[1])
+	}
+}
+
+func TestClientError(t *testing.T) {
+	var queries []string
+	client := newTestServer(t, &queries)
+
+	_, err := client.Service(context.Background(), "main cluster", "web-1", ServiceOptions{Region: "eu-west-1"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "service not found" {
+		t.Errorf("error %v, want *Error with 404 service not found", err)
+	}
+
+	_, err = New(client.baseURL, "wrong").WithHTTPClient(client.httpClient).Services(context.Background(), Filter{}, PageOptions{})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("error %v, want *Error with 401", err)
+	}
+}
+
+func TestClientAllServices(t *testing.T) {
+	var queries []string
+	client := newTestServer(t, &queries)
+	// the stand-in pages by the requested limit, pretend the server caps it at 2
+	client.httpClient = &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		query := r.URL.Query()
+		query.Set("limit", "2")
+		r.URL.RawQuery = query.Encode()
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	services, err := client.AllServices(context.Background(), Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 5 || services[4].Name != "web-5" {
+		t.Errorf("%d services, want all 5", len(services))
+	}
+	if len(queries) != 3 {
+		t.Errorf("%d requests, want 3 pages", len(queries))
+	}
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,151 @@
+package client
+
+import "net/netip"
+
+// Page is a page of items returned by list endpoints
+type Page[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// Cluster is a cluster with the number of its services, running tasks and hosts
+type Cluster struct {
+	Arn      string `json:"arn"`
+	Name     string `json:"name"`
+	Region   string `json:"region"`
+	Account  string `json:"account"`
+	Services int    `json:"services"`
+	Tasks    int    `json:"tasks"`
+	Hosts    int    `json:"hosts"`
+}
+
+// Service is an ECS service with the location of its cluster
+type Service struct {
+	Cluster        string         `json:"cluster"`
+	Region         string         `json:"region"`
+	Account        string         `json:"account"`
+	Name           string         `json:"name"`
+	Image          string         `json:"image"`
+	App            string         `json:"app"`
+	Env            string         `json:"env"`
+	Component      string         `json:"component"`
+	Container      string         `json:"container"`
+	Version        string         `json:"version"`
+	Addresses      []Address      `json:"addresses"`
+	TaskDefinition TaskDefinition `json:"taskDefinition"`
+	// LaunchType is empty when the service uses a capacity provider strategy
+	LaunchType        string             `json:"launchType"`
+	CapacityProviders []CapacityProvider `json:"capacityProviders"`
+	PlatformVersion   string             `json:"platformVersion"`
+	Tasks             []Task             `json:"tasks"`
+	DesiredCount      int32              `json:"desiredCount"`
+	RunningCount      int32              `json:"runningCount"`
+	PendingCount      int32              `json:"pendingCount"`
+	// RolloutState is the state of the primary deployment: IN_PROGRESS, COMPLETED or FAILED
+	RolloutState string `json:"rolloutState"`
+}
+
+type CapacityProvider struct {
+	Name   string `json:"name"`
+	Weight int32  `json:"weight"`
+	Base   int32  `json:"base"`
+}
+
+type Task struct {
+	Arn              string   `json:"arn"`
+	Group            string   `json:"group"`
+	StartedBy        string   `json:"startedBy"`
+	LaunchType       string   `json:"launchType"`
+	CapacityProvider string   `json:"capacityProvider"`
+	PlatformVersion  string   `json:"platformVersion"`
+	Spot             bool     `json:"spot"`
+	Containers       []string `json:"containers"`
+	// Addresses are addresses of the task network interface for awsvpc network mode, otherwise addresses of the host
+	Addresses []Address `json:"addresses"`
+	// Host is nil for Fargate tasks
+	Host *Host `json:"host,omitempty"`
+	// Bindings are host ports of containers in bridge and host network modes
+	Bindings []PortBinding `json:"bindings"`
+}
+
+type PortBinding struct {
+	Container     string `json:"container"`
+	ContainerPort int32  `json:"containerPort"`
+	HostPort      int32  `json:"hostPort"`
+	Protocol      string `json:"protocol"`
+}
+
+type Host struct {
+	// ID is EC2 instance ID or Systems Manager managed instance ID for external instances
+	ID        string    `json:"id"`
+	Hostname  string    `json:"hostname"`
+	Addresses []Address `json:"addresses"`
+	External  bool      `json:"external"`
+	Spot      bool      `json:"spot"`
+}
+
+type AddressKind string
+
+const (
+	AddressPrivate AddressKind = "private"
+	AddressPublic  AddressKind = "public"
+	AddressElastic AddressKind = "elastic"
+	AddressIPv6    AddressKind = "ipv6"
+)
+
+// Address is an IP address with its network placement, network fields are empty for external instances
+type Address struct {
+	IP               netip.Addr   `json:"ip"`
+	Kind             AddressKind  `json:"kind"`
+	VpcID            string       `json:"vpcId"`
+	VpcName          string       `json:"vpcName"`
+	SubnetID         string       `json:"subnetId"`
+	SubnetName       string       `json:"subnetName"`
+	SubnetCIDR       netip.Prefix `json:"subnetCidr"`
+	AvailabilityZone string       `json:"availabilityZone"`
+	EniID            string       `json:"eniId"`
+}
+
+type TaskDefinition struct {
+	Arn        string                `json:"arn"`
+	Family     string                `json:"family"`
+	Revision   int32                 `json:"revision"`
+	Cpu        string                `json:"cpu"`
+	Memory     string                `json:"memory"`
+	Containers []ContainerDefinition `json:"containers"`
+}
+
+// ContainerDefinition has names of environment variables only, their values are not exposed
+type ContainerDefinition struct {
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	Version      string            `json:"version"`
+	Cpu          int32             `json:"cpu"`
+	Memory       int32             `json:"memory"`
+	Environment  []string          `json:"environment"`
+	Secrets      map[string]string `json:"secrets"`
+	PortMappings []PortMapping     `json:"portMappings"`
+	LogDriver    string            `json:"logDriver"`
+	LogOptions   map[string]string `json:"logOptions"`
+	DockerLabels map[string]string `json:"dockerLabels"`
+}
+
+type PortMapping struct {
+	ContainerPort int32  `json:"containerPort"`
+	HostPort      int32  `json:"hostPort"`
+	Protocol      string `json:"protocol"`
+}
+
+// Owner is a service task, a standalone task or a host which owns the address
+type Owner struct {
+	Address    Address  `json:"address"`
+	Account    string   `json:"account"`
+	Region     string   `json:"region"`
+	Cluster    string   `json:"cluster"`
+	Service    string   `json:"service"`
+	Task       string   `json:"task"`
+	Containers []string `json:"containers"`
+	Host       string   `json:"host"`
+}